@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/ssh"
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// showConnectError explains why connecting to host failed with err and offers
+// to try again. Closing the dialog returns to the host list.
+func (u *ui) showConnectError(err error, host *sshconfig.Host) {
+	title, text := explainConnectError(err)
+
+	modal := tview.NewModal().
+		SetText(text + "\n\n" + err.Error()).
+		AddButtons([]string{"Retry", "Close"}).
+		SetDoneFunc(func(index int, label string) {
+			if label == "Retry" {
+				u.connect(host)
+				return
+			}
+			u.app.SetRoot(u.flex, true)
+		})
+
+	modal.SetTitle(title)
+	u.app.SetRoot(modal, true)
+}
+
+// explainConnectError returns a title for err and an explanation of what
+// likely went wrong.
+func explainConnectError(err error) (string, string) {
+	var jumpErr *ssh.ProxyJumpError
+	var dnsErr *ssh.DNSError
+	var timeoutErr *ssh.TimeoutError
+	var dialErr *ssh.DialError
+	var authErr *ssh.AuthError
+	var unknownErr *ssh.UnknownHostKeyError
+	var commandErr *ssh.ProxyCommandError
+	var channelErr *ssh.ChannelError
+
+	switch {
+	case errors.As(err, &jumpErr):
+		// Explain why the jump host failed
+		_, text := explainConnectError(jumpErr.Err)
+		return "Jump host failed", fmt.Sprintf("The connection goes through the jump host %s, which failed.\n\n%s", jumpErr.Jump, text)
+	case errors.As(err, &dnsErr):
+		return "Unknown host", fmt.Sprintf("The host name %s could not be resolved. Check HostName for typos and that you are connected to the network that knows it.", dnsErr.HostName)
+	case errors.As(err, &timeoutErr):
+		return "Connection timed out", fmt.Sprintf("%s did not answer within %s. The host may be down or a firewall may drop the connection, ConnectTimeout sets how long to wait.", timeoutErr.Addr, timeoutErr.Timeout)
+	case errors.As(err, &dialErr):
+		return "Connection failed", fmt.Sprintf("No connection to %s could be established. Check that the host is up, that the SSH server listens on that port and that no firewall is in the way.", dialErr.Addr)
+	case errors.As(err, &authErr):
+		if len(authErr.Methods) == 0 {
+			return "Authentication failed", "No authentication method was available. Check PreferredAuthentications, BatchMode and that an identity file or agent exists."
+		}
+		return "Authentication failed", fmt.Sprintf("The server did not accept the credentials of %s, tried %s. Check User, IdentityFile and that the key is authorized on the server.", authErr.User, strings.Join(authErr.Methods, ", "))
+	case errors.As(err, &unknownErr):
+		return "Unknown host key", fmt.Sprintf("The host key of %s is not known and StrictHostKeyChecking does not allow adding it. Add the key to your known hosts file or relax StrictHostKeyChecking.", unknownErr.Host)
+	case errors.As(err, &commandErr):
+		return "Proxy command failed", "The ProxyCommand exited or did not speak SSH. Its output, if any, is shown below."
+	case errors.As(err, &channelErr):
+		if channelErr.Rejected() {
+			return "Session refused", fmt.Sprintf("The server accepted the login but refused to %s. It may restrict what this user can do.", channelErr.Op)
+		}
+		return "Session failed", fmt.Sprintf("The server accepted the login but failed to %s.", channelErr.Op)
+	case errors.Is(err, ssh.ErrConnectionLost):
+		return "Connection lost", "The connection was lost while the session was open."
+	}
+	return "Connection failed", "The connection could not be established."
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/ssh"
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// newDetailsView creates the panel showing the effective options of the
+// selected host.
+func newDetailsView() *tview.TextView {
+	details := tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(false)
+
+	details.SetTitle("Details").SetBorder(true)
+
+	return details
+}
+
+// showDetails displays the effective options of host in the details panel.
+// Match exec commands are not run for that, only when connecting.
+func (u *ui) showDetails(host *sshconfig.Host) {
+	preview, ok := u.previews[host.Alias]
+	if !ok {
+		var err error
+		if preview, err = store.Preview(host.Alias); err != nil {
+			u.details.SetText("[red]" + tview.Escape(err.Error()))
+			return
+		}
+		u.previews[host.Alias] = preview
+	}
+
+	u.details.SetText(formatDetails(preview))
+}
+
+// formatDetails renders the effective options of host, each followed by the
+// file and line it came from, and the certificates used for the host. Hosts
+// that forward the agent start with a warning.
+func formatDetails(host *sshconfig.Host) string {
+	var b strings.Builder
+	if host.SkippedExec {
+		b.WriteString("[gray]Match exec blocks are only evaluated when connecting.[-]\n\n")
+	}
+	if ssh.ForwardsAgent(host) {
+		b.WriteString("[black:yellow] Forwards the SSH agent [-:-]\n[yellow]Anyone with root access on the server can use your keys while connected.[-]\n\n")
+	}
+	for _, o := range host.WithDefaults().Options {
+		fmt.Fprintf(&b, "[::b]%s[::-] %s\n  [gray]%s[-]\n",
+			o.Keyword, tview.Escape(sshconfig.JoinArgs(o.Args)), tview.Escape(optionOrigin(o)))
+	}
+
+	certs := ssh.Certificates(host)
+	if len(certs) > 0 {
+		b.WriteString("\n[::u]Certificates[::-]\n")
+	}
+	for _, cert := range certs {
+		fmt.Fprintf(&b, "[::b]%s[::-]\n", tview.Escape(displayPath(cert.Path)))
+
+		principals := "any"
+		if len(cert.ValidPrincipals) > 0 {
+			principals = strings.Join(cert.ValidPrincipals, ", ")
+		}
+		fmt.Fprintf(&b, "  Principals: %s\n", tview.Escape(principals))
+		fmt.Fprintf(&b, "  %s\n", formatValidity(cert))
+	}
+
+	return b.String()
+}
+
+// formatValidity describes until when cert is valid, highlighting
+// certificates that cannot be used right now.
+func formatValidity(cert *ssh.Certificate) string {
+	now := time.Now()
+	before := cert.ValidBefore()
+
+	switch {
+	case cert.Expired(now):
+		return "[red]Expired " + before.Format(time.DateTime) + "[-]"
+	case now.Before(cert.ValidAfter()):
+		return "[yellow]Valid from " + cert.ValidAfter().Format(time.DateTime) + "[-]"
+	case before.IsZero():
+		return "Valid forever"
+	}
+	return "Valid until " + before.Format(time.DateTime)
+}
+
+// expiredCertificates returns the certificates of host that have expired.
+func expiredCertificates(host *sshconfig.Host) []*ssh.Certificate {
+	var expired []*ssh.Certificate
+	for _, cert := range ssh.Certificates(host) {
+		if cert.Expired(time.Now()) {
+			expired = append(expired, cert)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/ssh"
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// hostForwards holds the port forwardings per alias, including those added
+// by hand, for as long as gossht runs. They keep the statistics of the last
+// connection.
+var hostForwards = make(map[string]*ssh.Forwards)
+
+// forwardKinds are the kinds of forwardings that can be added by hand.
+var forwardKinds = []struct {
+	label string
+	kind  byte
+}{
+	{"Local (-L)", 'L'},
+	{"Remote (-R)", 'R'},
+	{"Dynamic SOCKS proxy (-D)", 'D'},
+}
+
+// forwardsFor returns the port forwardings of host, updated to its current
+// config.
+func forwardsFor(host *sshconfig.Host) *ssh.Forwards {
+	forwards, ok := hostForwards[host.Alias]
+	if !ok {
+		forwards = ssh.NewForwards(host)
+		hostForwards[host.Alias] = forwards
+		return forwards
+	}
+
+	forwards.Configure(host)
+	return forwards
+}
+
+// showForwards shows the port forwardings of the selected host together with
+// the connections they forwarded, and lets forwardings be added and removed
+// by hand for the next connection.
+func (u *ui) showForwards() {
+	host := u.selectedHost()
+	if host == nil {
+		return
+	}
+
+	resolved, err := store.Resolve(host.Alias)
+	if err != nil {
+		showError(u.app, err, u.flex)
+		return
+	}
+	forwards := forwardsFor(resolved)
+
+	list := tview.NewTable().
+		SetSelectable(true, false).
+		SetFixed(1, 0)
+
+	list.SetTitle("Port forwards of " + host.Alias).SetBorder(true)
+
+	fill := func() {
+		list.Clear()
+		for i, header := range []string{"Forward", "Origin", "Listening on", "Connections", "Last error"} {
+			list.SetCell(0, i, tview.NewTableCell(header).SetSelectable(false).
+				SetBackgroundColor(AccentColor).SetTextColor(tcell.ColorWhite).SetAttributes(tcell.AttrBold))
+		}
+
+		for i, f := range forwards.List() {
+			origin := "added by hand"
+			if f.Option != nil {
+				origin = optionOrigin(*f.Option)
+			}
+			// Remote forwardings show the port the server chose
+			addr := f.Addr()
+			if addr != "" && !f.Listening() {
+				addr += " (closed)"
+			}
+			active, total := f.Connections()
+			lastErr := ""
+			if err := f.Err(); err != nil {
+				lastErr = err.Error()
+			}
+
+			list.SetCell(i+1, 0, tview.NewTableCell(tview.Escape(f.String())).SetReference(f).SetExpansion(1))
+			list.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(origin)).SetExpansion(1))
+			list.SetCell(i+1, 2, tview.NewTableCell(tview.Escape(addr)))
+			list.SetCell(i+1, 3, tview.NewTableCell(fmt.Sprintf("%d (%d open)", total, active)))
+			list.SetCell(i+1, 4, tview.NewTableCell(tview.Escape(lastErr)).SetTextColor(tcell.ColorRed).SetExpansion(2))
+		}
+	}
+	fill()
+
+	layout := tview.NewFlex().SetDirection(tview.FlexRow)
+
+	// Forwardings from the config have to be changed there
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if k := event.Key(); k != tcell.KeyDelete && k != tcell.KeyBackspace2 {
+			return event
+		}
+
+		row, _ := list.GetSelection()
+		if f, ok := list.GetCell(row, 0).GetReference().(*ssh.Forward); ok {
+			if f.Option != nil {
+				showError(u.app, fmt.Errorf("%s is configured in %s", f, optionOrigin(*f.Option)), layout)
+				return nil
+			}
+			forwards.Remove(f)
+			fill()
+		}
+		return nil
+	})
+
+	var labels []string
+	for _, k := range forwardKinds {
+		labels = append(labels, k.label)
+	}
+
+	form := tview.NewForm().
+		AddDropDown("Type", labels, 0, nil).
+		AddInputField("Forward", "", 40, nil, nil).
+		AddInputField("SOCKS user", "", 20, nil, nil).
+		AddPasswordField("SOCKS password", "", 20, '*', nil)
+
+	form.AddButton("Add", func() {
+		index, _ := form.GetFormItemByLabel("Type").(*tview.DropDown).GetCurrentOption()
+		spec := form.GetFormItemByLabel("Forward").(*tview.InputField)
+		user := form.GetFormItemByLabel("SOCKS user").(*tview.InputField)
+		password := form.GetFormItemByLabel("SOCKS password").(*tview.InputField)
+
+		// Only SOCKS proxies have credentials, without them those of the
+		// host apply
+		kind := forwardKinds[index].kind
+		var err error
+		if kind == 'D' {
+			err = forwards.AddDynamic(strings.TrimSpace(spec.GetText()), strings.TrimSpace(user.GetText()), password.GetText())
+		} else {
+			err = forwards.Add(kind, strings.TrimSpace(spec.GetText()))
+		}
+		if err != nil {
+			showError(u.app, err, layout)
+			return
+		}
+		spec.SetText("")
+		user.SetText("")
+		password.SetText("")
+		fill()
+	}).
+		AddButton("Back", func() {
+			u.app.SetRoot(u.flex, true)
+		})
+
+	styleForm(form)
+
+	form.SetTitle("Add forward, e.g. 8080:db.internal:5432 or 1080 for a SOCKS proxy").SetBorder(true)
+
+	form.SetCancelFunc(func() {
+		u.app.SetFocus(list)
+	})
+	list.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEscape:
+			u.app.SetRoot(u.flex, true)
+		case tcell.KeyTab:
+			u.app.SetFocus(form)
+		}
+	})
+
+	help := tview.NewTextView().
+		SetText("<TAB>: Add a forward  <DEL>: Remove a forward added by hand  <ESC>: Back")
+
+	layout.AddItem(list, 0, 1, true).
+		AddItem(form, 13, 0, false).
+		AddItem(help, 1, 0, false)
+
+	u.app.SetRoot(layout, true)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/ssh"
+	cryptossh "golang.org/x/crypto/ssh"
+)
+
+func (tuiPrompter) ConfirmHostKey(host string, key cryptossh.PublicKey) (bool, error) {
+	text := fmt.Sprintf("The authenticity of host %s can't be established.\n%s key fingerprint is %s\n\n%s\n\nAre you sure you want to continue connecting?",
+		host, key.Type(), cryptossh.FingerprintSHA256(key), ssh.RandomArt(key))
+
+	app := tview.NewApplication()
+	accepted := false
+
+	form := tview.NewForm().
+		AddButton("Yes", func() {
+			accepted = true
+			app.Stop()
+		}).
+		AddButton("No", app.Stop)
+
+	form.SetCancelFunc(app.Stop)
+
+	if err := showDialog(app, form, "Unknown host", text, 0); err != nil {
+		return false, err
+	}
+
+	return accepted, nil
+}
+
+// showHostKeyMismatch warns that the host key of a server has changed and
+// returns to back once the warning has been acknowledged.
+func showHostKeyMismatch(app *tview.Application, err *ssh.HostKeyMismatchError, back tview.Primitive) {
+	var known []string
+	for _, k := range err.Known {
+		known = append(known, fmt.Sprintf("%s key in %s:%d", k.Key.Type(), displayPath(k.Filename), k.Line))
+	}
+
+	text := fmt.Sprintf(`WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED!
+
+IT IS POSSIBLE THAT SOMEONE IS DOING SOMETHING NASTY!
+Someone could be eavesdropping on you right now (man-in-the-middle attack)!
+It is also possible that a host key has just been changed.
+
+The fingerprint for the %s key sent by %s is
+%s
+
+Known keys:
+%s
+
+The connection has been refused. If the change is expected, remove the
+old key with "ssh-keygen -R %s" and connect again.
+
+Press ENTER to continue`,
+		err.Key.Type(), err.Host, cryptossh.FingerprintSHA256(err.Key), strings.Join(known, "\n"), err.Host)
+
+	warning := tview.NewTextView().
+		SetText(text).
+		SetTextAlign(tview.AlignCenter).
+		SetTextColor(tcell.ColorWhite)
+
+	warning.SetBackgroundColor(tcell.ColorDarkRed)
+	warning.SetTitle("Host key mismatch").SetBorder(true)
+
+	warning.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEnter {
+			app.SetRoot(back, true)
+		}
+	})
+
+	app.SetRoot(warning, true)
+}
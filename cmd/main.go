@@ -1,35 +1,58 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/skryvvara/gossht/internal/clear"
+	"github.com/skryvvara/gossht/internal/hosts"
 	"github.com/skryvvara/gossht/internal/ssh"
+	"github.com/skryvvara/gossht/internal/sshconfig"
 )
 
 var (
-	flex    *tview.Flex
-	table   *tview.Table
+	store   = hosts.NewStore(hosts.DefaultBackend())
 	Version string // This is set during build time
 
 	AccentColor tcell.Color = tcell.NewHexColor(0x324191)
 )
 
+// ui holds the widgets of the host list, which dialogs return to once they
+// are done.
+type ui struct {
+	app     *tview.Application
+	flex    *tview.Flex
+	table   *tview.Table
+	details *tview.TextView
+
+	// previews holds the options of the hosts in the table per alias,
+	// resolved without running Match exec commands.
+	previews map[string]*sshconfig.Host
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "resolve" {
+		os.Exit(runResolve(os.Args[2:]))
+	}
+
 	StartTUI()
 }
 
 func StartTUI() {
 	// Create a new application
-	app := tview.NewApplication()
+	u := &ui{
+		app:      tview.NewApplication(),
+		previews: make(map[string]*sshconfig.Host),
+	}
 
 	// Create a flex container
-	flex = tview.NewFlex().SetDirection(tview.FlexRow)
+	u.flex = tview.NewFlex().SetDirection(tview.FlexRow)
 
 	// Create a box for the title
 	title := tview.NewTextView().
@@ -39,13 +62,13 @@ func StartTUI() {
 		SetDynamicColors(true) // Optional: enable dynamic colors
 
 	// Create a new table
-	table = tview.NewTable().
+	u.table = tview.NewTable().
 		SetSeparator('|').
 		SetSelectable(true, false).
 		SetFixed(1, 1).
 		SetEvaluateAllRows(true)
 
-	table.SetTitle("Connections").SetBorder(true)
+	u.table.SetTitle("Connections").SetBorder(true)
 
 	// Customize the selected cell style
 	selectedStyle := tcell.StyleDefault.
@@ -53,52 +76,108 @@ func StartTUI() {
 		Foreground(tcell.ColorWhite).
 		Attributes(tcell.AttrBold)
 
-	table.SetSelectedStyle(selectedStyle)
+	u.table.SetSelectedStyle(selectedStyle)
 
 	//table.SetBorderPadding(0, 0, 1, 0)
 
 	// Stop the application if ESCAPE has been pressed
-	table.SetDoneFunc(func(key tcell.Key) {
+	u.table.SetDoneFunc(func(key tcell.Key) {
 		if key == tcell.KeyEscape {
-			app.Stop()
+			u.app.Stop()
 		}
 	})
 
 	// Register key events
-	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+	u.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		k := event.Key()
 
 		switch k {
 		case tcell.KeyCtrlE: // Edit Entry
-			loadForm(app, true)
+			if u.app.GetFocus() == u.table {
+				u.loadForm(true)
+			}
 		case tcell.KeyCtrlN: // New Entry
-			loadForm(app, false)
+			if u.app.GetFocus() == u.table {
+				u.loadForm(false)
+			}
 		case tcell.KeyCtrlD: // Delete Entry
-			app.Stop()
+			if u.app.GetFocus() == u.table {
+				u.confirmDelete()
+			}
 		case tcell.KeyCtrlU: // Duplicate Entry
-			app.Stop()
+			if u.app.GetFocus() == u.table {
+				u.loadDuplicateForm()
+			}
+		case tcell.KeyCtrlP: // Port forwards
+			if u.app.GetFocus() == u.table {
+				u.showForwards()
+			}
+		case tcell.KeyCtrlZ: // Undo delete
+			if u.app.GetFocus() == u.table && store.CanUndo() {
+				if _, err := store.Undo(); err != nil {
+					showError(u.app, err, u.flex)
+				}
+			}
 		}
 
 		return event
 	})
 
-	loadSSHConfig()
+	// Keep the table in sync with the hosts of the store
+	store.Observe(func(e hosts.Event) {
+		u.syncTable(e)
+	})
+	loadErr := store.Load()
+
+	u.details = newDetailsView()
+
+	// Show the effective options of the entry under the cursor
+	u.table.SetSelectionChangedFunc(func(row, column int) {
+		if host, ok := u.table.GetCell(row, 0).GetReference().(*sshconfig.Host); ok {
+			u.showDetails(host)
+		} else {
+			u.details.Clear()
+		}
+	})
 
 	// Set selection handler for the table
-	table.SetSelectable(true, false).
+	u.table.SetSelectable(true, false).
 		SetSelectedFunc(func(row, column int) {
-			// Example: Print selected host details
-			//host := table.GetCell(row, 0).Text
-			name := table.GetCell(row, 1).Text
-			user := table.GetCell(row, 2).Text
+			host, ok := u.table.GetCell(row, 0).GetReference().(*sshconfig.Host)
+			if !ok {
+				return
+			}
 
-			app.Stop()
+			resolved, err := store.Resolve(host.Alias)
+			if err != nil {
+				showError(u.app, err, u.flex)
+				return
+			}
 
-			clear.CallClear()
-			ssh.SSHConnect(name+":22", user)
-			clear.CallClear()
+			// Warn about expired certificates, the server would reject them
+			if expired := expiredCertificates(resolved); len(expired) > 0 {
+				var names []string
+				for _, cert := range expired {
+					names = append(names, fmt.Sprintf("%s (expired %s)",
+						displayPath(cert.Path), cert.ValidBefore().Format(time.DateTime)))
+				}
+
+				modal := tview.NewModal().
+					SetText("The following certificates have expired:\n\n" + strings.Join(names, "\n") + "\n\nConnect anyway?").
+					AddButtons([]string{"Connect", "Cancel"}).
+					SetDoneFunc(func(index int, label string) {
+						if label == "Connect" {
+							u.connect(resolved)
+							return
+						}
+						u.app.SetRoot(u.flex, true)
+					})
+
+				u.app.SetRoot(modal, true)
+				return
+			}
 
-			StartTUI()
+			u.connect(resolved)
 		})
 
 	// Add headers with styling
@@ -107,9 +186,10 @@ func StartTUI() {
 			SetBackgroundColor(AccentColor).SetTextColor(tcell.ColorWhite).SetAttributes(tcell.AttrBold)
 	}
 
-	table.SetCell(0, 0, headerCell("Host"))
-	table.SetCell(0, 1, headerCell("HostName"))
-	table.SetCell(0, 2, headerCell("User"))
+	u.table.SetCell(0, 0, headerCell("Host"))
+	u.table.SetCell(0, 1, headerCell("HostName"))
+	u.table.SetCell(0, 2, headerCell("User"))
+	u.table.SetCell(0, 3, headerCell("File"))
 
 	infoBox := tview.NewGrid()
 
@@ -118,110 +198,290 @@ func StartTUI() {
 	//TODO: Remove this later
 	infoBox.AddItem(tview.NewTextView().SetText("<ESC>: Quit Application"), 0, 0, 1, 1, 1, 1, false)
 	infoBox.AddItem(tview.NewTextView().SetText("<ENTER>: Connect to the selected entry"), 1, 0, 1, 1, 1, 1, false)
-	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+E>: Edit Entry (Not yet implemented)"), 2, 0, 1, 1, 1, 1, false)
-	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+N>: New Entry (Not yet implemented)"), 0, 1, 1, 1, 1, 1, false)
-	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+D>: Delete Entry (Not yet implemented)"), 1, 1, 1, 1, 1, 1, false)
-	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+U>: Duplicate Entry (Not yet implemented)"), 2, 1, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+E>: Edit Entry"), 2, 0, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+N>: New Entry"), 0, 1, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+D>: Delete Entry"), 1, 1, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+U>: Duplicate Entry"), 2, 1, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+P>: Port forwards"), 0, 2, 1, 1, 1, 1, false)
+	infoBox.AddItem(tview.NewTextView().SetText("<CTRL+Z>: Undo Delete"), 1, 2, 1, 1, 1, 1, false)
+
+	// Show the table next to the details of the selected entry
+	body := tview.NewFlex().
+		AddItem(u.table, 0, 2, true).
+		AddItem(u.details, 0, 1, false)
 
 	// Add title and table to the flex container
-	flex.AddItem(title, 1, 1, false).
+	u.flex.AddItem(title, 1, 1, false).
 		AddItem(infoBox, 5, 1, false).
-		AddItem(table, 0, 8, true)
+		AddItem(body, 0, 8, true)
 
 	// Set the root flex container
-	if err := app.SetRoot(flex, true).Run(); err != nil {
+	u.app.SetRoot(u.flex, true)
+
+	// Explain why hosts are missing, printing it would be drawn over
+	if loadErr != nil {
+		showError(u.app, fmt.Errorf("Failed to read SSH config file: %w", loadErr), u.flex)
+	}
+
+	if err := u.app.Run(); err != nil {
 		panic(err)
 	}
 }
 
-func loadForm(app *tview.Application, preload bool) {
-	var name string
-	var hostname string
-	var user string
-	var title string
+// connect suspends the application, connects to host on the terminal and
+// resumes the application once the connection has been closed, showing why if
+// it could not be established. Lost connections are reconnected if the host
+// has a reconnect policy.
+func (u *ui) connect(host *sshconfig.Host) {
+	var err error
+	u.app.Suspend(func() {
+		clear.CallClear()
+		err = ssh.SSHConnect(host, store.Resolver(), tuiPrompter{}, forwardsFor(host))
+		if policy := ssh.NewReconnectPolicy(host); policy != nil && errors.Is(err, ssh.ErrConnectionLost) {
+			err = reconnect(host, policy, err)
+		}
+		clear.CallClear()
+	})
 
-	if preload {
-		x, _ := table.GetSelection()
+	var mismatch *ssh.HostKeyMismatchError
+	var dialogErr *dialogError
+	switch {
+	case errors.As(err, &dialogErr):
+		showError(u.app, dialogErr, u.flex)
+	case errors.As(err, &mismatch):
+		showHostKeyMismatch(u.app, mismatch, u.flex)
+	case err != nil && !errors.Is(err, ssh.ErrCancelled):
+		u.showConnectError(err, host)
+	default:
+		u.app.SetRoot(u.flex, true)
+	}
+}
 
-		name = table.GetCell(x, 0).Text
-		hostname = table.GetCell(x, 1).Text
-		user = table.GetCell(x, 2).Text
-		title = fmt.Sprintf("Edit entry %s", name)
-	} else {
-		title = "New entry"
+func (u *ui) loadForm(preload bool) {
+	var host *sshconfig.Host
+	var entry hosts.Entry
+	title := "New entry"
+
+	if preload {
+		if host = u.selectedHost(); host == nil {
+			return
+		}
+		entry = store.Entry(host)
+		title = fmt.Sprintf("Edit entry %s (%s)", host.Name(), displayPath(host.Block.Path))
 	}
 
 	formFlex := tview.NewFlex()
 
 	form := tview.NewForm().
-		AddInputField("Name", name, 20, nil, nil).
-		AddInputField("Hostname", hostname, 20, nil, nil).
-		AddInputField("User", user, 20, nil, nil).
-		AddTextArea("Notes", "", 40, 0, 0, nil).
+		AddInputField("Name", sshconfig.JoinArgs(entry.Patterns), 20, nil, nil).
+		AddInputField("Hostname", entry.HostName, 20, nil, nil).
+		AddInputField("User", entry.User, 20, nil, nil).
+		AddTextArea("Notes", entry.Notes, 40, 0, 0, nil).
 		AddPasswordField("Password", "", 10, '*', nil).
-		AddInputField("SSH-Key path", "", 20, nil, nil).
-		AddButton("Save", nil).
+		AddInputField("SSH-Key path", entry.IdentityFile, 20, nil, nil)
+
+	form.AddButton("Save", func() {
+		if err := saveEntry(form, host); err != nil {
+			showError(u.app, err, formFlex)
+			return
+		}
+
+		u.app.SetRoot(u.flex, true)
+	}).
 		AddButton("Quit", func() {
-			app.SetRoot(flex, true)
+			u.app.SetRoot(u.flex, true)
 		})
 
-	form.SetLabelColor(tcell.ColorWhite).
-		SetFieldBackgroundColor(AccentColor).
-		SetFieldTextColor(tcell.ColorWhite).
-		SetButtonBackgroundColor(AccentColor).
-		SetButtonTextColor(tcell.ColorWhite)
+	styleForm(form)
 
 	form.SetTitle(title).SetBorder(true)
 
 	formFlex.AddItem(form, 0, 1, true)
 
-	app.SetRoot(formFlex, true)
+	u.app.SetRoot(formFlex, true)
 }
 
-func loadSSHConfig() {
-	sshPath := path.Join(os.Getenv("HOME"), ".ssh", "config")
-	config, err := os.ReadFile(sshPath)
-	if err != nil {
-		fmt.Printf("Failed to read SSH config file: %v\n", err)
+// loadDuplicateForm asks for the name and HostName of a copy of the selected
+// host and inserts the copy right after it.
+func (u *ui) loadDuplicateForm() {
+	host := u.selectedHost()
+	if host == nil {
+		return
+	}
+	if store.ReadOnly(host) {
+		showError(u.app, fmt.Errorf("%s cannot be duplicated, %s is read-only", host.Name(), displayPath(host.Block.Path)), u.flex)
 		return
 	}
 
-	// Parse SSH config file and populate the table
-	lines := strings.Split(string(config), "\n")
-	rowIndex := 1 // Start after the headers
+	formFlex := tview.NewFlex()
 
-	var currentHost, currentName, currentUser string
+	form := tview.NewForm().
+		AddInputField("Name", host.Name(), 20, nil, nil).
+		AddInputField("Hostname", host.HostName, 20, nil, nil).
+		AddCheckbox("Copy comments", true, nil)
+
+	form.AddButton("Duplicate", func() {
+		patterns, err := sshconfig.SplitArgs(form.GetFormItemByLabel("Name").(*tview.InputField).GetText())
+		if err != nil {
+			showError(u.app, fmt.Errorf("invalid name: %w", err), formFlex)
+			return
+		}
+		hostName := strings.TrimSpace(form.GetFormItemByLabel("Hostname").(*tview.InputField).GetText())
+		comments := form.GetFormItemByLabel("Copy comments").(*tview.Checkbox).IsChecked()
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue // Skip empty lines and comments
+		if _, err := store.Duplicate(host, patterns, hostName, comments); err != nil {
+			showError(u.app, err, formFlex)
+			return
 		}
 
-		line = strings.ToLower(line)
+		u.app.SetRoot(u.flex, true)
+	}).
+		AddButton("Quit", func() {
+			u.app.SetRoot(u.flex, true)
+		})
+
+	styleForm(form)
+
+	form.SetTitle(fmt.Sprintf("Duplicate entry %s (%s)", host.Name(), displayPath(host.Block.Path))).SetBorder(true)
+
+	formFlex.AddItem(form, 0, 1, true)
+
+	u.app.SetRoot(formFlex, true)
+}
+
+// confirmDelete asks whether the selected host should be deleted and removes
+// its block from the file it belongs to if so.
+func (u *ui) confirmDelete() {
+	host := u.selectedHost()
+	if host == nil {
+		return
+	}
+	if store.ReadOnly(host) {
+		showError(u.app, fmt.Errorf("%s cannot be deleted, %s is read-only", host.Name(), displayPath(host.Block.Path)), u.flex)
+		return
+	}
 
-		// Detect Host entry
-		if strings.HasPrefix(line, "host ") {
-			// Add previous host entry to table
-			if currentHost != "" {
-				addHostEntryToTable(rowIndex, currentHost, currentName, currentUser)
-				rowIndex++
+	modal := tview.NewModal().
+		SetText(fmt.Sprintf("Delete %s from %s?\n\nPress <CTRL+Z> to undo.", host.Name(), displayPath(host.Block.Path))).
+		AddButtons([]string{"Delete", "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			u.app.SetRoot(u.flex, true)
+			if label != "Delete" {
+				return
 			}
-			currentHost = strings.TrimSpace(strings.TrimPrefix(line, "host "))
-		} else if strings.HasPrefix(line, "hostname ") {
-			currentName = strings.TrimSpace(strings.TrimPrefix(line, "hostname "))
-		} else if strings.HasPrefix(line, "user ") {
-			currentUser = strings.TrimSpace(strings.TrimPrefix(line, "user "))
+			if err := store.Remove(host); err != nil {
+				showError(u.app, err, u.flex)
+			}
+		})
+
+	u.app.SetRoot(modal, true)
+}
+
+// saveEntry writes the values of the entry form to the Host block of host, or
+// to a new Host block in the main config file if host is nil.
+func saveEntry(form *tview.Form, host *sshconfig.Host) error {
+	text := func(label string) string {
+		switch item := form.GetFormItemByLabel(label).(type) {
+		case *tview.InputField:
+			return strings.TrimSpace(item.GetText())
+		case *tview.TextArea:
+			return item.GetText()
+		}
+		return ""
+	}
+
+	patterns, err := sshconfig.SplitArgs(text("Name"))
+	if err != nil {
+		return fmt.Errorf("invalid name: %w", err)
+	}
+	entry := hosts.Entry{
+		Patterns:     patterns,
+		HostName:     text("Hostname"),
+		User:         text("User"),
+		IdentityFile: text("SSH-Key path"),
+		Notes:        text("Notes"),
+	}
+	if host != nil {
+		_, err = store.Update(host, entry)
+	} else {
+		_, err = store.Add(entry)
+	}
+	return err
+}
+
+// styleForm applies the colors shared by all forms.
+func styleForm(form *tview.Form) {
+	form.SetLabelColor(tcell.ColorWhite).
+		SetFieldBackgroundColor(AccentColor).
+		SetFieldTextColor(tcell.ColorWhite).
+		SetButtonBackgroundColor(AccentColor).
+		SetButtonTextColor(tcell.ColorWhite)
+}
+
+// showError displays err in a modal dialog and returns to back once it has
+// been dismissed.
+func showError(app *tview.Application, err error, back tview.Primitive) {
+	modal := tview.NewModal().
+		SetText(err.Error()).
+		AddButtons([]string{"OK"}).
+		SetDoneFunc(func(int, string) {
+			app.SetRoot(back, true)
+		})
+
+	app.SetRoot(modal, true)
+}
+
+// syncTable replaces the host rows of the table with the hosts of the store
+// after it changed with e. The selection moves to a host that was added or
+// updated, otherwise it stays in its row.
+func (u *ui) syncTable(e hosts.Event) {
+	row, _ := u.table.GetSelection()
+	for u.table.GetRowCount() > 1 {
+		u.table.RemoveRow(u.table.GetRowCount() - 1)
+	}
+	u.previews = make(map[string]*sshconfig.Host)
+
+	// Populate the table, starting after the headers
+	list := store.Hosts()
+	for i, host := range list {
+		u.addHostEntryToTable(i+1, host)
+		if host == e.Host && e.Kind != hosts.Removed {
+			row = i + 1
 		}
 	}
+	u.markAgentForwarding(list)
+	u.table.Select(max(min(row, len(list)), 1), 0)
+}
+
+// selectedHost returns the host in the selected row of the table, or nil if
+// there is none.
+func (u *ui) selectedHost() *sshconfig.Host {
+	row, _ := u.table.GetSelection()
+	host, _ := u.table.GetCell(row, 0).GetReference().(*sshconfig.Host)
+	return host
+}
+
+// agentBadge follows the name of hosts that forward the agent.
+const agentBadge = " [black:yellow] agent [-:-]"
+
+// markAgentForwarding adds a badge to the rows of the hosts in list that
+// forward the agent, which any block matching them can enable. Hosts are
+// previewed, so Match exec blocks cannot enable the badge.
+func (u *ui) markAgentForwarding(list []*sshconfig.Host) {
+	for i, host := range list {
+		preview, err := store.Preview(host.Alias)
+		if err != nil {
+			continue
+		}
 
-	// Add the last host entry to table
-	if currentHost != "" {
-		addHostEntryToTable(rowIndex, currentHost, currentName, currentUser)
+		u.previews[host.Alias] = preview
+		if ssh.ForwardsAgent(preview) {
+			u.table.GetCell(i+1, 0).SetText(host.Name() + agentBadge)
+		}
 	}
 }
 
-func addHostEntryToTable(row int, host, name, user string) {
+func (u *ui) addHostEntryToTable(row int, host *sshconfig.Host) {
 	// Normal cell style
 	tableCell := func(content string) *tview.TableCell {
 		return tview.NewTableCell(content).
@@ -231,8 +491,22 @@ func addHostEntryToTable(row int, host, name, user string) {
 			SetExpansion(1) // Expand to fill available width
 	}
 
-	// Add the cell to the table
-	table.SetCell(row, 0, tableCell(host))
-	table.SetCell(row, 1, tableCell(name))
-	table.SetCell(row, 2, tableCell(user))
+	// Add the cell to the table, the first cell keeps a reference to the host
+	u.table.SetCell(row, 0, tableCell(host.Name()).SetReference(host))
+	u.table.SetCell(row, 1, tableCell(host.HostName))
+	u.table.SetCell(row, 2, tableCell(host.User))
+	u.table.SetCell(row, 3, tableCell(displayPath(host.Block.Path)))
+}
+
+// displayPath shortens path for display by replacing the home directory
+// with ~.
+func displayPath(path string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.Join("~", rel)
+	}
+	return path
 }
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/ssh"
+)
+
+// tuiPrompter asks for secrets with dialogs while a connection is set up.
+// The host list is suspended at that point, so every prompt runs a small
+// application of its own on the terminal.
+type tuiPrompter struct{}
+
+func (tuiPrompter) Passphrase(path string) (string, error) {
+	answers, err := promptFields("Passphrase",
+		fmt.Sprintf("Enter passphrase for key %s", displayPath(path)),
+		[]promptField{{secret: true}})
+	if err != nil {
+		return "", err
+	}
+	return answers[0], nil
+}
+
+func (tuiPrompter) Password(user, host string) (string, error) {
+	answers, err := promptFields("Password",
+		fmt.Sprintf("%s@%s's password", user, host),
+		[]promptField{{secret: true}})
+	if err != nil {
+		return "", err
+	}
+	return answers[0], nil
+}
+
+func (tuiPrompter) Challenge(name, instruction string, questions []string, echos []bool) ([]string, error) {
+	title := name
+	if title == "" {
+		title = "Authentication"
+	}
+
+	fields := make([]promptField, len(questions))
+	for i, q := range questions {
+		fields[i] = promptField{label: strings.TrimSpace(q), secret: !echos[i]}
+	}
+
+	return promptFields(title, instruction, fields)
+}
+
+// promptField is an input field of a prompt dialog.
+type promptField struct {
+	label  string
+	secret bool
+}
+
+// promptFields shows a dialog with the message text and one input field per
+// entry of fields. It returns the entered texts, or ssh.ErrCancelled if the
+// dialog was dismissed.
+func promptFields(title, text string, fields []promptField) ([]string, error) {
+	app := tview.NewApplication()
+
+	answers := make([]string, len(fields))
+	err := ssh.ErrCancelled
+
+	submit := func() {
+		err = nil
+		app.Stop()
+	}
+
+	form := tview.NewForm()
+	for i, f := range fields {
+		changed := func(text string) {
+			answers[i] = text
+		}
+		if f.secret {
+			form.AddPasswordField(f.label, "", 40, '*', changed)
+		} else {
+			form.AddInputField(f.label, "", 40, nil, changed)
+		}
+
+		// ENTER in the last field submits the form
+		if i == len(fields)-1 {
+			form.GetFormItem(i).(*tview.InputField).SetDoneFunc(func(key tcell.Key) {
+				if key == tcell.KeyEnter {
+					submit()
+				}
+			})
+		}
+	}
+
+	form.AddButton("OK", submit).
+		AddButton("Cancel", func() {
+			app.Stop()
+		})
+
+	form.SetCancelFunc(app.Stop)
+
+	if dialogErr := showDialog(app, form, title, text, len(fields)); dialogErr != nil {
+		return nil, dialogErr
+	}
+
+	return answers, err
+}
+
+// dialogError is returned if a dialog could not be run on the terminal.
+type dialogError struct {
+	err error
+}
+
+func (e *dialogError) Error() string {
+	return fmt.Sprintf("failed to show a dialog: %v", e.err)
+}
+
+func (e *dialogError) Unwrap() error {
+	return e.err
+}
+
+// showDialog runs app with form centered below the message text until the
+// application is stopped.
+func showDialog(app *tview.Application, form *tview.Form, title, text string, fields int) error {
+	styleForm(form)
+
+	message := tview.NewTextView().
+		SetText(text).
+		SetTextAlign(tview.AlignCenter).
+		SetWordWrap(true)
+
+	// Leave room for the fields, one line each with a line of spacing, and
+	// the buttons
+	formHeight := fields*2 + 3
+
+	// Make room for longer messages, counting wrapped lines
+	textHeight := 0
+	for _, line := range strings.Split(text, "\n") {
+		textHeight += len(line)/66 + 1
+	}
+	textHeight = max(textHeight, 6)
+
+	dialog := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(message, 0, 1, false).
+		AddItem(form, formHeight, 0, true)
+
+	dialog.SetTitle(title).SetBorder(true)
+
+	// Center the dialog on the screen
+	layout := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(nil, 0, 1, false).
+			AddItem(dialog, formHeight+textHeight+2, 0, true).
+			AddItem(nil, 0, 1, false), 70, 0, true).
+		AddItem(nil, 0, 1, false)
+
+	if err := app.SetRoot(layout, true).Run(); err != nil {
+		return &dialogError{err: err}
+	}
+	return nil
+}
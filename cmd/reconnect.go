@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/skryvvara/gossht/internal/clear"
+	"github.com/skryvvara/gossht/internal/ssh"
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// reconnect connects to host again after its connection was lost with err,
+// as long as the reconnect policy allows and the user does not cancel. It
+// returns the error of the last attempt or of showing the countdown, or nil if
+// it was cancelled or the session ended normally.
+func reconnect(host *sshconfig.Host, policy *ssh.ReconnectPolicy, err error) error {
+	host = policy.Host(host)
+
+	failed := 0
+	for ssh.Retryable(err) {
+		// Start over if the last attempt got connected before it was lost
+		if errors.Is(err, ssh.ErrConnectionLost) {
+			failed = 0
+		} else {
+			failed++
+		}
+		if policy.Exhausted(failed) {
+			return err
+		}
+
+		again, dialogErr := countdown(host, err, failed+1, policy)
+		if dialogErr != nil {
+			return dialogErr
+		}
+		if !again {
+			return nil
+		}
+
+		clear.CallClear()
+		err = ssh.SSHConnect(host, store.Resolver(), tuiPrompter{}, forwardsFor(host))
+	}
+
+	return err
+}
+
+// countdown shows why the connection to host failed and counts down to the
+// given reconnect attempt. It returns false if reconnecting was cancelled.
+func countdown(host *sshconfig.Host, err error, attempt int, policy *ssh.ReconnectPolicy) (bool, error) {
+	app := tview.NewApplication()
+	remaining := int(policy.Delay(attempt).Seconds())
+	reconnect := false
+
+	attempts := fmt.Sprintf("attempt %d", attempt)
+	if policy.MaxAttempts > 0 {
+		attempts += fmt.Sprintf(" of %d", policy.MaxAttempts)
+	}
+	text := func() string {
+		return fmt.Sprintf("%v\n\nReconnecting to %s in %d seconds (%s)", err, host.Alias, remaining, attempts)
+	}
+
+	modal := tview.NewModal().
+		SetText(text()).
+		AddButtons([]string{"Reconnect now", "Cancel"}).
+		SetDoneFunc(func(index int, label string) {
+			reconnect = label == "Reconnect now"
+			app.Stop()
+		})
+
+	modal.SetTitle("Connection lost")
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			app.QueueUpdateDraw(func() {
+				remaining--
+				if remaining <= 0 {
+					reconnect = true
+					app.Stop()
+					return
+				}
+				modal.SetText(text())
+			})
+		}
+	}()
+
+	runErr := app.SetRoot(modal, true).Run()
+	close(done)
+	if runErr != nil {
+		return false, &dialogError{err: runErr}
+	}
+
+	return reconnect, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// resolvedOption is the JSON representation of an effective option.
+type resolvedOption struct {
+	Keyword string   `json:"keyword"`
+	Value   string   `json:"value"`
+	Args    []string `json:"args"`
+	File    string   `json:"file,omitempty"`
+	Line    int      `json:"line,omitempty"`
+}
+
+// runResolve implements "gossht resolve <alias>", which prints the effective
+// options for alias together with the file and line each one came from,
+// similar to "ssh -G".
+func runResolve(args []string) int {
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the options as JSON")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: gossht resolve [-json] <alias>")
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	// Parsing stops at the alias, so flags following it would be ignored
+	for _, arg := range flags.Args()[min(1, flags.NArg()):] {
+		if strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(flags.Output(), "Flags have to come before the alias: %s\n", arg)
+			flags.Usage()
+			return 2
+		}
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := store.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read SSH config file: %v\n", err)
+		return 1
+	}
+
+	host, err := store.Resolve(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve %s: %v\n", flags.Arg(0), err)
+		return 1
+	}
+	host = host.WithDefaults()
+
+	if *asJSON {
+		err = writeResolvedJSON(os.Stdout, host)
+	} else {
+		err = writeResolvedText(os.Stdout, host)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func writeResolvedText(w io.Writer, host *sshconfig.Host) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, o := range host.Options {
+		fmt.Fprintf(tw, "%s\t%s\t# %s\n", strings.ToLower(o.Keyword), sshconfig.JoinArgs(o.Args), optionOrigin(o))
+	}
+	return tw.Flush()
+}
+
+func writeResolvedJSON(w io.Writer, host *sshconfig.Host) error {
+	options := make([]resolvedOption, 0, len(host.Options))
+	for _, o := range host.Options {
+		options = append(options, resolvedOption{
+			Keyword: o.Keyword,
+			Value:   o.Value(),
+			Args:    o.Args,
+			File:    o.Path,
+			Line:    o.Line,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Host    string           `json:"host"`
+		Options []resolvedOption `json:"options"`
+	}{host.Alias, options})
+}
+
+// optionOrigin describes where an option came from.
+func optionOrigin(o sshconfig.Option) string {
+	if o.Path == "" {
+		return "default"
+	}
+	return fmt.Sprintf("%s:%d", displayPath(o.Path), o.Line)
+}
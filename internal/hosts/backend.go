@@ -0,0 +1,70 @@
+package hosts
+
+import (
+	"errors"
+	"io/fs"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// Backend reads and writes the config files of a Store.
+type Backend interface {
+	// Load reads the user and system config files, including the files
+	// they include. The user config is never nil, if it could not be read
+	// an empty config is returned together with the error. The system
+	// config may be nil.
+	Load() (user, system *sshconfig.Config, err error)
+	// Save writes file, which is the user config or one it includes.
+	Save(file *sshconfig.Config) error
+	// Writable reports whether file can be saved.
+	Writable(file *sshconfig.Config) bool
+}
+
+// FileBackend reads and writes config files on disk.
+type FileBackend struct {
+	UserPath   string
+	SystemPath string
+}
+
+// DefaultBackend returns the backend for the default user and system config
+// files.
+func DefaultBackend() *FileBackend {
+	return &FileBackend{
+		UserPath:   sshconfig.DefaultUserConfig(),
+		SystemPath: sshconfig.DefaultSystemConfig(),
+	}
+}
+
+// Load reads the config files. Missing files are not an error, a missing user
+// config is created when the first host is added.
+func (b *FileBackend) Load() (*sshconfig.Config, *sshconfig.Config, error) {
+	user, userErr := sshconfig.Load(b.UserPath)
+	if userErr != nil {
+		// Only allow creating the file if it does not exist yet, a file that
+		// failed to parse must never be overwritten
+		user = &sshconfig.Config{}
+		if errors.Is(userErr, fs.ErrNotExist) {
+			user.Path = b.UserPath
+			userErr = nil
+		}
+	}
+
+	// The system config only contributes options, its hosts are not listed
+	system, systemErr := sshconfig.LoadSystem(b.SystemPath)
+	if errors.Is(systemErr, fs.ErrNotExist) {
+		systemErr = nil
+	}
+
+	return user, system, errors.Join(userErr, systemErr)
+}
+
+// Save writes file back to disk.
+func (b *FileBackend) Save(file *sshconfig.Config) error {
+	return file.Save()
+}
+
+// Writable reports whether the user may replace file, files that failed to
+// parse never are.
+func (b *FileBackend) Writable(file *sshconfig.Config) bool {
+	return file.Path != "" && writable(file.Path)
+}
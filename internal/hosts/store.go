@@ -0,0 +1,433 @@
+// Package hosts keeps the hosts of the user's config files, validates and
+// persists changes to them and notifies observers about those changes.
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// EventKind tells what changed in a Store.
+type EventKind int
+
+const (
+	// Reloaded means every host may have changed.
+	Reloaded EventKind = iota
+	// Added means a host was added.
+	Added
+	// Updated means the block of a host was changed.
+	Updated
+	// Removed means a host was removed.
+	Removed
+)
+
+// Event describes a change of a Store.
+type Event struct {
+	Kind EventKind
+	// Host is the host that was added, updated or removed, as it is now or,
+	// for removed hosts, as it was. It is nil for Reloaded.
+	Host *sshconfig.Host
+}
+
+// Entry holds the fields of a Host block that can be edited.
+type Entry struct {
+	Patterns     []string
+	HostName     string
+	User         string
+	IdentityFile string
+	Notes        string
+}
+
+// Store holds the hosts of the user config and the files it includes. All
+// changes go through the store, which saves the affected file with its
+// backend and then notifies the observers.
+type Store struct {
+	backend Backend
+
+	mu      sync.RWMutex
+	user    *sshconfig.Config
+	system  *sshconfig.Config
+	hosts   []*sshconfig.Host
+	removed []removal // Removed hosts that can be restored, in the order removed
+
+	observers []func(Event)
+}
+
+// removal is a host removed from file.
+type removal struct {
+	file  *sshconfig.Config
+	block *sshconfig.RemovedBlock
+}
+
+// NewStore returns an empty store that reads and writes with backend. Call
+// Load to read the hosts.
+func NewStore(backend Backend) *Store {
+	return &Store{backend: backend, user: &sshconfig.Config{}}
+}
+
+// Observe registers f to be called after every change of the store. It is
+// called by the method that made the change, after the store was unlocked.
+func (s *Store) Observe(f func(Event)) {
+	s.observers = append(s.observers, f)
+}
+
+func (s *Store) notify(e Event) {
+	for _, f := range s.observers {
+		f(e)
+	}
+}
+
+// Load reads the config files again. The hosts that could be read are
+// available even if an error is returned.
+func (s *Store) Load() error {
+	user, system, err := s.backend.Load()
+
+	s.mu.Lock()
+	s.user, s.system = user, system
+	s.hosts = user.Hosts()
+	s.removed = nil
+	s.mu.Unlock()
+
+	s.notify(Event{Kind: Reloaded})
+	return err
+}
+
+// Hosts returns the hosts of all Host blocks in the order they are read.
+func (s *Store) Hosts() []*sshconfig.Host {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*sshconfig.Host(nil), s.hosts...)
+}
+
+// Resolve returns the options that apply to alias according to the user and
+// system config files.
+func (s *Store) Resolve(alias string) (*sshconfig.Host, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resolver().Resolve(alias)
+}
+
+// Preview returns the options that apply to alias like Resolve, but leaves
+// out Match blocks with exec criteria instead of running their commands. It
+// is meant for display, connections have to use Resolve.
+func (s *Store) Preview(alias string) (*sshconfig.Host, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r := s.resolver()
+	r.SkipExec = true
+	return r.Resolve(alias)
+}
+
+// Resolver returns a resolver for the current config files. Unlike Resolve,
+// it does not keep the store from being changed while it is used.
+func (s *Store) Resolver() *sshconfig.Resolver {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.resolver()
+}
+
+func (s *Store) resolver() *sshconfig.Resolver {
+	return &sshconfig.Resolver{User: s.user, System: s.system}
+}
+
+// Entry returns the editable fields of host.
+func (s *Store) Entry(host *sshconfig.Host) Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e := Entry{
+		Patterns: host.Patterns(),
+		HostName: host.HostName,
+		User:     host.User,
+	}
+	if len(host.IdentityFiles) > 0 {
+		e.IdentityFile = host.IdentityFiles[0]
+	}
+	if host.Block != nil {
+		if file := s.user.File(host.Block.Path); file != nil {
+			e.Notes = file.Notes(host.Block)
+		}
+	}
+	return e
+}
+
+// Validate checks e before it is written as the block of host, which is nil
+// for a new host.
+func (s *Store) Validate(e Entry, host *sshconfig.Host) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.validate(e, host)
+}
+
+func (s *Store) validate(e Entry, host *sshconfig.Host) error {
+	if len(e.Patterns) == 0 {
+		return errors.New("name must not be empty")
+	}
+
+	alias := ""
+	for _, p := range e.Patterns {
+		if alias == "" && !strings.HasPrefix(p, "!") {
+			alias = p
+		}
+	}
+	if alias == "" {
+		return errors.New("name needs a pattern that is not negated")
+	}
+
+	for _, f := range []struct{ label, value string }{
+		{"hostname", e.HostName},
+		{"user", e.User},
+	} {
+		if strings.ContainsAny(f.value, " \t") {
+			return fmt.Errorf("%s must not contain spaces", f.label)
+		}
+	}
+
+	// Files may already name several blocks alike, keeping a name is fine
+	if host != nil && host.Alias == alias {
+		return nil
+	}
+	for _, h := range s.hosts {
+		if h.Alias == alias {
+			return fmt.Errorf("a host named %s already exists in %s", alias, h.Block.Path)
+		}
+	}
+
+	return nil
+}
+
+// Add validates e and appends it as a new Host block to the user config.
+func (s *Store) Add(e Entry) (*sshconfig.Host, error) {
+	s.mu.Lock()
+	file := s.user
+	if !s.backend.Writable(file) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%s is read-only", file.Path)
+	}
+	if err := s.validate(e, nil); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	host, err := s.edit(file, func() (*sshconfig.Block, error) {
+		block, err := file.AddHost(e.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		return block, writeEntry(file, block, e)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(Event{Kind: Added, Host: host})
+	return host, nil
+}
+
+// Update validates e and writes it to the block of host, in the file the
+// block belongs to.
+func (s *Store) Update(host *sshconfig.Host, e Entry) (*sshconfig.Host, error) {
+	s.mu.Lock()
+	if err := s.validate(e, host); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	file, err := s.file(host)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	updated, err := s.edit(file, func() (*sshconfig.Block, error) {
+		if err := file.SetPatterns(host.Block, e.Patterns); err != nil {
+			return nil, err
+		}
+		// Edits keep the Host line where it is
+		return host.Block, writeEntry(file, host.Block, e)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(Event{Kind: Updated, Host: updated})
+	return updated, nil
+}
+
+// Duplicate inserts a copy of the block of host with all its options right
+// after it, in the same file, named by patterns and with hostName as
+// HostName. Comments within the block are only copied if comments is set.
+func (s *Store) Duplicate(host *sshconfig.Host, patterns []string, hostName string, comments bool) (*sshconfig.Host, error) {
+	s.mu.Lock()
+	if err := s.validate(Entry{Patterns: patterns, HostName: hostName}, nil); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	file, err := s.file(host)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	duplicate, err := s.edit(file, func() (*sshconfig.Block, error) {
+		block, err := file.DuplicateHost(host.Block, patterns, comments)
+		if err != nil {
+			return nil, err
+		}
+
+		var args []string
+		if hostName != "" {
+			args = []string{hostName}
+		}
+		return block, file.SetOption(block, "HostName", args)
+	})
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(Event{Kind: Added, Host: duplicate})
+	return duplicate, nil
+}
+
+// Remove removes the block of host from the file it belongs to. The removal
+// can be undone with Undo until the store is loaded again.
+func (s *Store) Remove(host *sshconfig.Host) error {
+	s.mu.Lock()
+	file, err := s.file(host)
+	if err == nil {
+		var removed *sshconfig.RemovedBlock
+		_, err = s.edit(file, func() (*sshconfig.Block, error) {
+			removed, err = file.RemoveHost(host.Block)
+			return nil, err
+		})
+		if err == nil {
+			s.removed = append(s.removed, removal{file: file, block: removed})
+		}
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.notify(Event{Kind: Removed, Host: host})
+	return nil
+}
+
+// CanUndo reports whether there is a removal to undo.
+func (s *Store) CanUndo() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.removed) > 0
+}
+
+// Undo restores the host removed last where it was and returns it.
+func (s *Store) Undo() (*sshconfig.Host, error) {
+	s.mu.Lock()
+	if len(s.removed) == 0 {
+		s.mu.Unlock()
+		return nil, errors.New("nothing to undo")
+	}
+	r := s.removed[len(s.removed)-1]
+
+	host, err := s.edit(r.file, func() (*sshconfig.Block, error) {
+		return r.file.Restore(r.block)
+	})
+	if err == nil {
+		s.removed = s.removed[:len(s.removed)-1]
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify(Event{Kind: Added, Host: host})
+	return host, nil
+}
+
+// ReadOnly reports whether the block of host is in a file that cannot be
+// changed, such as an Include owned by another user.
+func (s *Store) ReadOnly(host *sshconfig.Host) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, err := s.file(host)
+	return err != nil
+}
+
+// file returns the config file the block of host belongs to, if it can be
+// changed.
+func (s *Store) file(host *sshconfig.Host) (*sshconfig.Config, error) {
+	if host.Block == nil {
+		return nil, fmt.Errorf("%s is not a Host block", host.Alias)
+	}
+	file := s.user.File(host.Block.Path)
+	if file == nil {
+		return nil, fmt.Errorf("%s is no longer part of the config", host.Block.Path)
+	}
+	if !s.backend.Writable(file) {
+		return nil, fmt.Errorf("%s is read-only", host.Block.Path)
+	}
+	return file, nil
+}
+
+// edit applies change to file, saves it and returns the host of the block
+// returned by change, if any. If either fails, file is rolled back so the
+// failed change is not saved with the next one. The store has to be locked.
+func (s *Store) edit(file *sshconfig.Config, change func() (*sshconfig.Block, error)) (*sshconfig.Host, error) {
+	snapshot := file.Snapshot()
+	block, err := change()
+	if err == nil {
+		err = s.backend.Save(file)
+	}
+	if err != nil {
+		file.Rollback(snapshot)
+	}
+	s.hosts = s.user.Hosts()
+	if err != nil || block == nil {
+		return nil, err
+	}
+
+	for _, h := range s.hosts {
+		if sameBlock(h.Block, block) {
+			return h, nil
+		}
+	}
+	return nil, errors.New("the changed block is missing")
+}
+
+// writeEntry writes the fields of e other than the patterns to block. Notes
+// are only rewritten if they changed.
+func writeEntry(file *sshconfig.Config, block *sshconfig.Block, e Entry) error {
+	if e.Notes != file.Notes(block) {
+		if err := file.SetNotes(block, e.Notes); err != nil {
+			return err
+		}
+	}
+
+	options := []struct{ keyword, value string }{
+		{"HostName", e.HostName},
+		{"User", e.User},
+		{"IdentityFile", e.IdentityFile},
+	}
+	for _, o := range options {
+		var args []string
+		if o.value != "" {
+			args = []string{o.value}
+		}
+		if err := file.SetOption(block, o.keyword, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameBlock reports whether a and b are the same block, which may have been
+// rebuilt by an edit in the meantime.
+func sameBlock(a, b *sshconfig.Block) bool {
+	return a != nil && b != nil && a.Path == b.Path && a.Line == b.Line
+}
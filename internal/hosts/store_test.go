@@ -0,0 +1,300 @@
+package hosts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// fakeBackend keeps the user config in memory and records what was saved.
+type fakeBackend struct {
+	text     string
+	readOnly bool
+	saveErr  error
+	saved    string
+}
+
+func (b *fakeBackend) Load() (*sshconfig.Config, *sshconfig.Config, error) {
+	user, err := sshconfig.Parse(strings.NewReader(b.text), "config")
+	if err != nil {
+		return &sshconfig.Config{}, nil, err
+	}
+	return user, nil, nil
+}
+
+func (b *fakeBackend) Save(file *sshconfig.Config) error {
+	if b.saveErr != nil {
+		return b.saveErr
+	}
+	b.saved = string(file.Bytes())
+	return nil
+}
+
+func (b *fakeBackend) Writable(file *sshconfig.Config) bool {
+	return !b.readOnly
+}
+
+const testConfig = `# Web server
+Host web
+    HostName web.example.com
+    User deploy
+
+Host db
+    HostName db.example.com
+`
+
+func newTestStore(t *testing.T) (*Store, *fakeBackend) {
+	t.Helper()
+	backend := &fakeBackend{text: testConfig}
+	store := NewStore(backend)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return store, backend
+}
+
+func findHost(t *testing.T, store *Store, alias string) *sshconfig.Host {
+	t.Helper()
+	for _, h := range store.Hosts() {
+		if h.Alias == alias {
+			return h
+		}
+	}
+	t.Fatalf("host %s not found", alias)
+	return nil
+}
+
+func aliases(store *Store) string {
+	var names []string
+	for _, h := range store.Hosts() {
+		names = append(names, h.Alias)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestAdd(t *testing.T) {
+	store, backend := newTestStore(t)
+
+	var events []Event
+	store.Observe(func(e Event) { events = append(events, e) })
+
+	host, err := store.Add(Entry{Patterns: []string{"cache"}, HostName: "cache.example.com", User: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Alias != "cache" || host.HostName != "cache.example.com" || host.User != "admin" {
+		t.Errorf("got host %s %s@%s", host.Alias, host.User, host.HostName)
+	}
+	if got := aliases(store); got != "web db cache" {
+		t.Errorf("got hosts %q", got)
+	}
+	if !strings.Contains(backend.saved, "Host cache\n") || !strings.Contains(backend.saved, "HostName cache.example.com\n") {
+		t.Errorf("saved config misses the new host:\n%s", backend.saved)
+	}
+	if len(events) != 1 || events[0].Kind != Added || events[0].Host != host {
+		t.Errorf("got events %+v", events)
+	}
+
+	if _, err := store.Add(Entry{Patterns: []string{"web"}}); err == nil {
+		t.Error("adding a duplicate alias succeeded")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	store, backend := newTestStore(t)
+
+	web := findHost(t, store, "web")
+	e := store.Entry(web)
+	e.Patterns = []string{"www"}
+	e.User = ""
+	updated, err := store.Update(web, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Alias != "www" || updated.User != "" || updated.HostName != "web.example.com" {
+		t.Errorf("got host %s %s@%s", updated.Alias, updated.User, updated.HostName)
+	}
+	if strings.Contains(backend.saved, "User deploy") {
+		t.Errorf("saved config still has the removed user:\n%s", backend.saved)
+	}
+
+	if _, err := store.Update(updated, Entry{Patterns: []string{"db"}}); err == nil {
+		t.Error("renaming to an existing alias succeeded")
+	}
+}
+
+func TestUpdateKeepsOtherBytes(t *testing.T) {
+	text := "Host old\r\n\t#HostName old.example.com\r\n\t#  indented   note\r\n\tHostName = \"old.example.com\"\r\n\tUser root # admin\r\n\tIdentityFile ~/.ssh/id_old\r\n\r\nHost other\r\n  Port 2222"
+	backend := &fakeBackend{text: text}
+	store := NewStore(backend)
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	host := findHost(t, store, "old")
+	e := store.Entry(host)
+	e.User = "deploy"
+	if _, err := store.Update(host, e); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(text, "User root", "User deploy", 1)
+	if backend.saved != want {
+		t.Errorf("got config\n%q\nwant\n%q", backend.saved, want)
+	}
+
+	// Changed notes keep the prefix of the lines they replace
+	host = findHost(t, store, "old")
+	e = store.Entry(host)
+	e.Notes = strings.Replace(e.Notes, "indented", "changed", 1) + "\nnew note"
+	if _, err := store.Update(host, e); err != nil {
+		t.Fatal(err)
+	}
+	want = strings.Replace(want, "\t#  indented   note\r\n", "\t#  changed   note\r\n\t# new note\r\n", 1)
+	if backend.saved != want {
+		t.Errorf("got config\n%q\nwant\n%q", backend.saved, want)
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	store, backend := newTestStore(t)
+
+	web := findHost(t, store, "web")
+	dup, err := store.Duplicate(web, []string{"web2"}, "web2.example.com", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dup.HostName != "web2.example.com" || dup.User != "deploy" {
+		t.Errorf("got host %s@%s", dup.User, dup.HostName)
+	}
+	if got := aliases(store); got != "web web2 db" {
+		t.Errorf("got hosts %q", got)
+	}
+	if !strings.Contains(backend.saved, "HostName web.example.com\n") {
+		t.Errorf("saved config lost the original:\n%s", backend.saved)
+	}
+}
+
+func TestRemoveUndo(t *testing.T) {
+	store, backend := newTestStore(t)
+
+	if store.CanUndo() {
+		t.Error("CanUndo before removing")
+	}
+	if err := store.Remove(findHost(t, store, "web")); err != nil {
+		t.Fatal(err)
+	}
+	if got := aliases(store); got != "db" {
+		t.Errorf("got hosts %q", got)
+	}
+	if strings.Contains(backend.saved, "Web server") {
+		t.Errorf("saved config still has the comment of the removed host:\n%s", backend.saved)
+	}
+	if !store.CanUndo() {
+		t.Fatal("cannot undo the removal")
+	}
+
+	host, err := store.Undo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Alias != "web" {
+		t.Errorf("restored %s", host.Alias)
+	}
+	if backend.saved != testConfig {
+		t.Errorf("restored config differs:\n%s", backend.saved)
+	}
+	if store.CanUndo() {
+		t.Error("CanUndo after undoing the only removal")
+	}
+	if _, err := store.Undo(); err == nil {
+		t.Error("Undo without removals succeeded")
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	store, backend := newTestStore(t)
+	backend.readOnly = true
+
+	web := findHost(t, store, "web")
+	if !store.ReadOnly(web) {
+		t.Error("ReadOnly is false")
+	}
+	if _, err := store.Update(web, store.Entry(web)); err == nil {
+		t.Error("Update succeeded")
+	}
+	if err := store.Remove(web); err == nil {
+		t.Error("Remove succeeded")
+	}
+	if _, err := store.Add(Entry{Patterns: []string{"cache"}}); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("Add error = %v, want a read-only error", err)
+	}
+	if store.CanUndo() {
+		t.Error("a refused removal can be undone")
+	}
+	if backend.saved != "" {
+		t.Errorf("saved a read-only file:\n%s", backend.saved)
+	}
+}
+
+func TestSaveFailure(t *testing.T) {
+	store, backend := newTestStore(t)
+	backend.saveErr = errors.New("disk full")
+
+	var events []Event
+	store.Observe(func(e Event) { events = append(events, e) })
+
+	if _, err := store.Add(Entry{Patterns: []string{"cache"}}); err == nil {
+		t.Error("Add succeeded")
+	}
+	web := findHost(t, store, "web")
+	if err := store.Remove(web); err == nil {
+		t.Error("Remove succeeded")
+	}
+	if store.CanUndo() {
+		t.Error("a failed removal can be undone")
+	}
+	if got := aliases(store); got != "web db" {
+		t.Errorf("got hosts %q after failed edits", got)
+	}
+	if len(events) != 0 {
+		t.Errorf("got events %+v", events)
+	}
+
+	// The failed edits must not be saved with the next one
+	backend.saveErr = nil
+	db := findHost(t, store, "db")
+	e := store.Entry(db)
+	e.User = "root"
+	if _, err := store.Update(db, e); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(testConfig, "db.example.com\n", "db.example.com\n    User root\n", 1)
+	if backend.saved != want {
+		t.Errorf("got config\n%s\nwant\n%s", backend.saved, want)
+	}
+}
+
+func TestUndoSaveFailure(t *testing.T) {
+	store, backend := newTestStore(t)
+
+	if err := store.Remove(findHost(t, store, "web")); err != nil {
+		t.Fatal(err)
+	}
+	backend.saveErr = errors.New("disk full")
+	if _, err := store.Undo(); err == nil {
+		t.Fatal("Undo succeeded")
+	}
+	if !store.CanUndo() {
+		t.Error("a failed undo dropped the removal")
+	}
+
+	backend.saveErr = nil
+	if _, err := store.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if backend.saved != testConfig {
+		t.Errorf("restored config differs:\n%s", backend.saved)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package hosts
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// writable reports whether the file at path can be replaced, judging by its
+// permissions.
+func writable(path string) bool {
+	fi, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return true
+	}
+	return err == nil && fi.Mode().Perm()&0o200 != 0
+}
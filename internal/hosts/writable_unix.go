@@ -0,0 +1,22 @@
+//go:build unix
+
+package hosts
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// writable reports whether the file at path can be replaced, which needs
+// write access to its directory as well.
+func writable(path string) bool {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if unix.Access(filepath.Dir(path), unix.W_OK) != nil {
+		return false
+	}
+	err := unix.Access(path, unix.W_OK)
+	return err == nil || err == unix.ENOENT
+}
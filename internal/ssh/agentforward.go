@@ -0,0 +1,51 @@
+package ssh
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// ForwardsAgent reports whether the agent is forwarded to host with
+// ForwardAgent, which lets anyone with root access on the server use the
+// keys of the agent for as long as the connection is open.
+func ForwardsAgent(host *sshconfig.Host) bool {
+	switch strings.ToLower(host.Get("ForwardAgent")) {
+	case "", "no", "false":
+		return false
+	}
+	return true
+}
+
+// forwardAgentSocket returns the path of the agent socket to forward to host,
+// or an empty string if the agent is not forwarded. ForwardAgent is "yes" for
+// the agent used for authentication, the path of a socket, or the name of an
+// environment variable holding the path, starting with "$".
+func forwardAgentSocket(host *sshconfig.Host) string {
+	value := host.Get("ForwardAgent")
+	switch {
+	case !ForwardsAgent(host):
+		return ""
+	case strings.EqualFold(value, "yes"), strings.EqualFold(value, "true"):
+		return agentSocket(host)
+	case strings.HasPrefix(value, "$"):
+		return os.Getenv(value[1:])
+	}
+	return sshconfig.ExpandPath(host.Tokens().Expand(value))
+}
+
+// forwardAgent forwards the agent listening on socket to the server and
+// requests it for session.
+func forwardAgent(client *ssh.Client, session *ssh.Session, socket string) error {
+	if socket == "" {
+		return errors.New("no agent socket to forward")
+	}
+	if err := agent.ForwardToRemote(client, socket); err != nil {
+		return err
+	}
+	return agent.RequestAgentForwarding(session)
+}
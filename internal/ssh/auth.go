@@ -0,0 +1,349 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// maxPassphraseAttempts is how often the passphrase of a key is asked for
+// before the key is skipped.
+const maxPassphraseAttempts = 3
+
+// ErrCancelled is returned by a Prompter if the user dismissed the prompt.
+var ErrCancelled = errors.New("cancelled by user")
+
+// defaultPreferredAuthentications is the order in which authentication
+// methods are tried if a host has no PreferredAuthentications.
+const defaultPreferredAuthentications = "publickey,keyboard-interactive,password"
+
+// defaultPasswordPrompts is how often a password is asked for if a host has
+// no NumberOfPasswordPrompts.
+const defaultPasswordPrompts = 3
+
+// Prompter asks the user for secrets and decisions while a connection is set
+// up.
+type Prompter interface {
+	// Passphrase asks for the passphrase of the encrypted private key at
+	// path. A non-nil error means the key should be skipped.
+	Passphrase(path string) (string, error)
+	// Password asks for the password of user on host.
+	Password(user, host string) (string, error)
+	// Challenge asks the questions of a keyboard-interactive challenge
+	// sent by the server, along with its name and instruction. Answers to
+	// questions whose echo flag is false should not be shown on screen.
+	Challenge(name, instruction string, questions []string, echos []bool) ([]string, error)
+	// ConfirmHostKey asks whether key should be trusted as the host key of
+	// host, which is not in the known hosts files yet.
+	ConfirmHostKey(host string, key ssh.PublicKey) (bool, error)
+}
+
+// authMethods returns the authentication methods for host in the order of
+// PreferredAuthentications. Public key authentication uses the agent, if
+// any, and the identity files; password and keyboard-interactive
+// authentication ask the prompter. Methods disabled in the config, and the
+// interactive ones in BatchMode or without a prompter, are left out. The
+// methods record in attempts when they are tried.
+func authMethods(host *sshconfig.Host, agentClient agent.ExtendedAgent, prompter Prompter, attempts *authAttempts) []ssh.AuthMethod {
+	if host.Flag("BatchMode") {
+		prompter = nil
+	}
+
+	preferred := host.Get("PreferredAuthentications")
+	if preferred == "" {
+		preferred = defaultPreferredAuthentications
+	}
+
+	prompts := defaultPasswordPrompts
+	if n, err := strconv.Atoi(host.Get("NumberOfPasswordPrompts")); err == nil {
+		prompts = n
+	}
+
+	// Authentication methods are enabled unless set to "no"
+	enabled := func(keyword string) bool {
+		v := strings.ToLower(host.Get(keyword))
+		return v != "no" && v != "false"
+	}
+
+	var methods []ssh.AuthMethod
+	for _, name := range strings.Split(preferred, ",") {
+		switch strings.TrimSpace(name) {
+		case "publickey":
+			if !enabled("PubkeyAuthentication") {
+				continue
+			}
+			// The encrypted keys are offered in a second round, so nobody is
+			// asked for passphrases if the agent or a plain key is accepted
+			var encrypted []*encryptedKey
+			round := 0
+			methods = append(methods, ssh.RetryableAuthMethod(
+				ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+					round++
+					if round == 1 {
+						attempts.add("publickey")
+						var signers []ssh.Signer
+						signers, encrypted = publicKeySigners(host, agentClient, prompter)
+						return signers, nil
+					}
+					return decryptedSigners(host, encrypted), nil
+				}), 2))
+		case "keyboard-interactive":
+			if prompter == nil || prompts <= 0 || !enabled("KbdInteractiveAuthentication") {
+				continue
+			}
+			methods = append(methods, ssh.RetryableAuthMethod(
+				ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+					attempts.add("keyboard-interactive")
+					// Servers may send an empty challenge, there is nothing to ask then
+					if len(questions) == 0 && name == "" && instruction == "" {
+						return nil, nil
+					}
+					return prompter.Challenge(name, instruction, questions, echos)
+				}), prompts))
+		case "password":
+			if prompter == nil || prompts <= 0 || !enabled("PasswordAuthentication") {
+				continue
+			}
+			methods = append(methods, ssh.RetryableAuthMethod(
+				ssh.PasswordCallback(func() (string, error) {
+					attempts.add("password")
+					return prompter.Password(host.User, host.HostName)
+				}), prompts))
+		}
+	}
+
+	return methods
+}
+
+// defaultIdentityFiles are tried if a host has no IdentityFile.
+var defaultIdentityFiles = []string{
+	"~/.ssh/id_rsa",
+	"~/.ssh/id_ecdsa",
+	"~/.ssh/id_ed25519",
+}
+
+// identityFiles returns the expanded paths of the private keys for host.
+func identityFiles(host *sshconfig.Host) []string {
+	files := host.IdentityFiles
+	if len(files) == 0 {
+		files = defaultIdentityFiles
+	}
+
+	tokens := host.Tokens()
+	var paths []string
+	for _, f := range files {
+		if strings.EqualFold(f, "none") {
+			continue
+		}
+		paths = append(paths, sshconfig.ExpandPath(tokens.Expand(f)))
+	}
+	return paths
+}
+
+// SSHAgent connects to the agent configured for host with IdentityAgent, or
+// the one in SSH_AUTH_SOCK. The returned closer ends the connection to the
+// agent. Both are nil if no agent is available.
+func SSHAgent(host *sshconfig.Host) (agent.ExtendedAgent, io.Closer) {
+	socket := agentSocket(host)
+	if socket == "" {
+		return nil, nil
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil
+	}
+	return agent.NewClient(conn), conn
+}
+
+// agentSocket returns the path of the agent socket set with IdentityAgent,
+// or the one in SSH_AUTH_SOCK. It is empty if there is none.
+func agentSocket(host *sshconfig.Host) string {
+	socket := host.IdentityAgent
+	switch {
+	case strings.EqualFold(socket, "none"):
+		return ""
+	case socket == "" || socket == "SSH_AUTH_SOCK":
+		return os.Getenv("SSH_AUTH_SOCK")
+	}
+	return sshconfig.ExpandPath(host.Tokens().Expand(socket))
+}
+
+// publicKeySigners returns the signers for public key authentication that
+// need no passphrase, and the encrypted identity files the agent does not
+// hold. Identities held by the agent are used through the agent; other
+// identity files are loaded from disk. With IdentitiesOnly only keys
+// matching an identity file are used. Certificates are tried before the plain
+// keys.
+func publicKeySigners(host *sshconfig.Host, agentClient agent.ExtendedAgent, prompter Prompter) ([]ssh.Signer, []*encryptedKey) {
+	var agentSigners []ssh.Signer
+	if agentClient != nil {
+		agentSigners, _ = agentClient.Signers()
+	}
+
+	var signers []ssh.Signer
+	var encrypted []*encryptedKey
+	used := make(map[string]bool)
+
+	for _, path := range identityFiles(host) {
+		signer, key, err := loadIdentity(path, prompter)
+		if err != nil {
+			continue
+		}
+
+		// Prefer the agent if it holds the same key
+		var public ssh.PublicKey
+		if signer != nil {
+			public = signer.PublicKey()
+		} else {
+			public = key.public
+		}
+		if public == nil {
+			encrypted = append(encrypted, key)
+			continue
+		}
+		marshaled := string(public.Marshal())
+		for _, s := range agentSigners {
+			if string(s.PublicKey().Marshal()) == marshaled {
+				signer = s
+				break
+			}
+		}
+
+		if used[marshaled] {
+			continue
+		}
+		used[marshaled] = true
+
+		if signer != nil {
+			signers = append(signers, signer)
+		} else {
+			encrypted = append(encrypted, key)
+		}
+	}
+
+	// Certificates may belong to any key of the agent, even with
+	// IdentitiesOnly, as the certificate file names the key to use
+	candidates := append([]ssh.Signer{}, signers...)
+	candidates = append(candidates, agentSigners...)
+	certSigners := certificateSigners(host, candidates)
+
+	if !host.IdentitiesOnly {
+		for _, s := range agentSigners {
+			if !used[string(s.PublicKey().Marshal())] {
+				signers = append(signers, s)
+			}
+		}
+	}
+
+	return append(certSigners, signers...), encrypted
+}
+
+// decryptedSigners asks for the passphrases of the encrypted keys and returns
+// signers for those that could be decrypted, preceded by their certificates.
+// Keys that cannot be decrypted are skipped, as failing to sign would end
+// authentication.
+func decryptedSigners(host *sshconfig.Host, keys []*encryptedKey) []ssh.Signer {
+	var signers []ssh.Signer
+	for _, key := range keys {
+		if err := key.decrypt(); err == nil {
+			signers = append(signers, key.signer)
+		}
+	}
+	return append(certificateSigners(host, signers), signers...)
+}
+
+// loadIdentity reads the private key at path. It returns a signer for keys
+// that are not encrypted, and the encrypted key otherwise, whose public key is
+// taken from the key file or the .pub file next to it if possible.
+func loadIdentity(path string, prompter Prompter) (ssh.Signer, *encryptedKey, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(pem)
+	if err == nil {
+		return signer, nil, nil
+	}
+
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if prompter == nil {
+		return nil, nil, fmt.Errorf("%s: key is encrypted", path)
+	}
+
+	key := &encryptedKey{path: path, pem: pem, prompter: prompter, public: missing.PublicKey}
+	if key.public == nil {
+		key.public = readPublicKey(path + ".pub")
+	}
+	return nil, key, nil
+}
+
+// readPublicKey reads a public key in authorized_keys format, returning nil
+// if the file does not exist or cannot be parsed.
+func readPublicKey(path string) ssh.PublicKey {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// encryptedKey is an encrypted private key that is only decrypted if the
+// keys that need no passphrase were not accepted.
+type encryptedKey struct {
+	path     string
+	pem      []byte
+	prompter Prompter
+	public   ssh.PublicKey // nil if unknown before decrypting
+	signer   ssh.Signer
+}
+
+// decrypt asks for the passphrase of the key until it is correct or the
+// maximum number of attempts is reached.
+func (s *encryptedKey) decrypt() error {
+	if s.signer != nil {
+		return nil
+	}
+
+	for i := 0; i < maxPassphraseAttempts; i++ {
+		passphrase, err := s.prompter.Passphrase(s.path)
+		if err != nil {
+			return err
+		}
+
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(s.pem, []byte(passphrase))
+		if errors.Is(err, x509.IncorrectPasswordError) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.path, err)
+		}
+
+		if s.public != nil && !bytes.Equal(signer.PublicKey().Marshal(), s.public.Marshal()) {
+			return fmt.Errorf("%s: public key does not match %s", s.path, filepath.Base(s.path)+".pub")
+		}
+		s.signer = signer
+		return nil
+	}
+
+	return fmt.Errorf("%s: incorrect passphrase", s.path)
+}
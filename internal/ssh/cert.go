@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"bytes"
+	"strings"
+	"time"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// Certificate is an OpenSSH user certificate configured for a host.
+type Certificate struct {
+	Path string
+	*ssh.Certificate
+}
+
+// Certificates returns the user certificates for host: the files listed with
+// CertificateFile followed by the "-cert.pub" files next to its identity
+// files. Files that do not exist or hold no user certificate are skipped.
+func Certificates(host *sshconfig.Host) []*Certificate {
+	tokens := host.Tokens()
+
+	var paths []string
+	for _, f := range host.GetAll("CertificateFile") {
+		if strings.EqualFold(f, "none") {
+			continue
+		}
+		paths = append(paths, sshconfig.ExpandPath(tokens.Expand(f)))
+	}
+	for _, f := range identityFiles(host) {
+		paths = append(paths, f+"-cert.pub")
+	}
+
+	var certs []*Certificate
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		cert, ok := readPublicKey(path).(*ssh.Certificate)
+		if !ok || cert.CertType != ssh.UserCert {
+			continue
+		}
+
+		key := string(cert.Marshal())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		certs = append(certs, &Certificate{Path: path, Certificate: cert})
+	}
+
+	return certs
+}
+
+// ValidAfter returns the time from which the certificate is valid.
+func (c *Certificate) ValidAfter() time.Time {
+	return time.Unix(int64(c.Certificate.ValidAfter), 0)
+}
+
+// ValidBefore returns the time until which the certificate is valid, or the
+// zero time if it does not expire.
+func (c *Certificate) ValidBefore() time.Time {
+	if c.Certificate.ValidBefore == ssh.CertTimeInfinity {
+		return time.Time{}
+	}
+	return time.Unix(int64(c.Certificate.ValidBefore), 0)
+}
+
+// Expired reports whether the certificate is no longer valid at t.
+func (c *Certificate) Expired(t time.Time) bool {
+	before := c.ValidBefore()
+	return !before.IsZero() && !t.Before(before)
+}
+
+// Valid reports whether the certificate is valid at t.
+func (c *Certificate) Valid(t time.Time) bool {
+	return !t.Before(c.ValidAfter()) && !c.Expired(t)
+}
+
+// certificateSigners returns a signer for each certificate of host that is
+// currently valid and whose key is held by one of signers. Certificates that
+// have expired are left out since the server would reject them anyway.
+func certificateSigners(host *sshconfig.Host, signers []ssh.Signer) []ssh.Signer {
+	now := time.Now()
+
+	var certSigners []ssh.Signer
+	for _, cert := range Certificates(host) {
+		if !cert.Valid(now) {
+			continue
+		}
+
+		key := cert.Key.Marshal()
+		for _, s := range signers {
+			if !bytes.Equal(s.PublicKey().Marshal(), key) {
+				continue
+			}
+			if signer, err := ssh.NewCertSigner(cert.Certificate, s); err == nil {
+				certSigners = append(certSigners, signer)
+			}
+			break
+		}
+	}
+
+	return certSigners
+}
@@ -0,0 +1,171 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Besides the errors in this file, connecting can fail with a
+// *HostKeyMismatchError, *UnknownHostKeyError, *ProxyCommandError,
+// *sshconfig.ParseError, ErrCancelled or ErrConnectionLost.
+
+// DNSError is returned if the name of a host could not be resolved.
+type DNSError struct {
+	HostName string
+	Err      error
+}
+
+func (e *DNSError) Error() string {
+	return fmt.Sprintf("could not resolve %s: %v", e.HostName, e.Err)
+}
+
+func (e *DNSError) Unwrap() error {
+	return e.Err
+}
+
+// DialError is returned if no TCP connection to a host could be established,
+// for example because it refused the connection or is unreachable.
+type DialError struct {
+	Addr string
+	Err  error
+}
+
+func (e *DialError) Error() string {
+	return fmt.Sprintf("could not connect to %s: %v", e.Addr, e.Err)
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned if connecting to a host, including the key
+// exchange, took longer than its ConnectTimeout. It matches
+// os.ErrDeadlineExceeded.
+type TimeoutError struct {
+	Addr    string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("connection to %s timed out after %s", e.Addr, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == os.ErrDeadlineExceeded
+}
+
+// AuthError is returned if the server accepted none of the authentication
+// methods that were tried.
+type AuthError struct {
+	User    string
+	Host    string
+	Methods []string // The methods that were tried, in order
+	Err     error
+}
+
+func (e *AuthError) Error() string {
+	tried := "no authentication method was available"
+	if len(e.Methods) > 0 {
+		tried = "tried " + strings.Join(e.Methods, ", ")
+	}
+	return fmt.Sprintf("permission denied for %s@%s (%s)", e.User, e.Host, tried)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError is returned if an option of a host cannot be used as it is
+// configured, such as a ProxyJump without a host.
+type ConfigError struct {
+	Keyword string
+	Err     error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Keyword, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ProxyJumpError is returned if connecting to a jump host of ProxyJump
+// failed. Err tells why.
+type ProxyJumpError struct {
+	Jump string
+	Err  error
+}
+
+func (e *ProxyJumpError) Error() string {
+	return fmt.Sprintf("jump host %s: %v", e.Jump, e.Err)
+}
+
+func (e *ProxyJumpError) Unwrap() error {
+	return e.Err
+}
+
+// ChannelError is returned if the server refused or failed a step of setting
+// up the session, such as opening it or allocating a pseudo-terminal.
+type ChannelError struct {
+	Op  string // What failed, such as "open a session"
+	Err error
+}
+
+func (e *ChannelError) Error() string {
+	return fmt.Sprintf("failed to %s: %v", e.Op, e.Err)
+}
+
+func (e *ChannelError) Unwrap() error {
+	return e.Err
+}
+
+// Rejected reports whether the server refused to open the channel, as
+// opposed to the channel failing.
+func (e *ChannelError) Rejected() bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(e.Err, &openErr)
+}
+
+// authAttempts records the authentication methods tried while connecting.
+type authAttempts struct {
+	mu      sync.Mutex
+	methods []string
+}
+
+func (a *authAttempts) add(method string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !slices.Contains(a.methods, method) {
+		a.methods = append(a.methods, method)
+	}
+}
+
+func (a *authAttempts) list() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.methods...)
+}
+
+// authenticating reports whether err happened once the host key had been
+// accepted, while authenticating, rather than in the transport below.
+func authenticating(err error) bool {
+	var authErr *AuthError
+	var mismatch *HostKeyMismatchError
+	var unknown *UnknownHostKeyError
+	return errors.As(err, &authErr) || errors.As(err, &mismatch) ||
+		errors.As(err, &unknown) || errors.Is(err, ErrCancelled)
+}
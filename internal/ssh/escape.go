@@ -0,0 +1,289 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultEscapeChar is used if a host has no EscapeChar.
+const defaultEscapeChar = '~'
+
+// noEscapeChar disables escape sequences.
+const noEscapeChar = -1
+
+// breakLength is the duration of a break sent with the break escape, in
+// milliseconds, the same OpenSSH uses.
+const breakLength = 1000
+
+// parseEscapeChar returns the escape character for an EscapeChar value,
+// which is a single character, a control character written as "^X", or
+// "none".
+func parseEscapeChar(value string) int {
+	switch {
+	case value == "":
+		return defaultEscapeChar
+	case strings.EqualFold(value, "none"):
+		return noEscapeChar
+	case len(value) == 2 && value[0] == '^' && value[1] >= 64 && value[1] < 128:
+		return int(value[1] & 31)
+	case len(value) == 1:
+		return int(value[0])
+	}
+	return defaultEscapeChar
+}
+
+// forwarder manages the port forwardings of a connection from the escape
+// command line.
+type forwarder interface {
+	// Describe describes the forwardings and their connections.
+	Describe() []string
+	// Add starts a forwarding given as on the ssh command line, where flag
+	// is L, R or D.
+	Add(flag byte, spec string) error
+	// Cancel stops the forwarding of flag that listens on the address of
+	// spec.
+	Cancel(flag byte, spec string) error
+}
+
+// escapeFilter reads the input of an interactive session and handles the
+// OpenSSH escape sequences in it, which start with the escape character at
+// the beginning of a line. Everything else is passed on.
+type escapeFilter struct {
+	r    io.Reader
+	w    io.Writer // Where messages are written, in raw mode
+	char int
+
+	host       string
+	session    *ssh.Session
+	forwards   forwarder // May be nil
+	disconnect func()
+	suspend    func() error
+
+	lineStart bool
+	escaped   bool
+
+	buf []byte
+	in  []byte // Input that has not been handled yet
+	out []byte // Input that has not been passed on yet
+}
+
+func newEscapeFilter(r io.Reader, w io.Writer, char int) *escapeFilter {
+	return &escapeFilter{
+		r:         r,
+		w:         w,
+		char:      char,
+		lineStart: true,
+		buf:       make([]byte, 4096),
+	}
+}
+
+func (f *escapeFilter) Read(p []byte) (int, error) {
+	// Only block for more input while there is nothing to pass on
+	for len(f.out) == 0 || (len(f.in) > 0 && len(f.out) < len(p)) {
+		c, err := f.readByte()
+		if err != nil {
+			if len(f.out) > 0 {
+				break
+			}
+			return 0, err
+		}
+		f.handle(c)
+	}
+
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	return n, nil
+}
+
+func (f *escapeFilter) readByte() (byte, error) {
+	for len(f.in) == 0 {
+		n, err := f.r.Read(f.buf)
+		f.in = f.buf[:n]
+		if n == 0 && err != nil {
+			return 0, err
+		}
+	}
+
+	c := f.in[0]
+	f.in = f.in[1:]
+	return c, nil
+}
+
+func (f *escapeFilter) handle(c byte) {
+	if !f.escaped {
+		if f.lineStart && int(c) == f.char {
+			f.escaped = true
+			return
+		}
+		f.out = append(f.out, c)
+		f.lineStart = c == '\r' || c == '\n'
+		return
+	}
+
+	// Commands leave the cursor at the start of a line, so another escape
+	// sequence can follow right away
+	f.escaped = false
+	switch c {
+	case '.':
+		f.printf("%s.\r\nConnection to %s closed.\r\n", f.escapeName(), f.host)
+		f.disconnect()
+	case 0x1a: // ^Z
+		f.printf("%s^Z [suspend ssh]\r\n", f.escapeName())
+		if err := f.suspend(); err != nil {
+			f.printf("Failed to suspend: %v\r\n", err)
+		}
+	case '#':
+		f.printf("%s#\r\n", f.escapeName())
+		f.listForwards()
+	case 'C':
+		f.commandLine()
+	case 'B':
+		f.printf("%sB\r\n", f.escapeName())
+		f.sendBreak()
+	case '?':
+		f.printf("%s?\r\n", f.escapeName())
+		f.help()
+	default:
+		// Anything else is sent as typed, a doubled escape character once
+		if int(c) != f.char {
+			f.out = append(f.out, byte(f.char))
+		}
+		f.out = append(f.out, c)
+		f.lineStart = c == '\r' || c == '\n'
+	}
+}
+
+func (f *escapeFilter) printf(format string, args ...any) {
+	fmt.Fprintf(f.w, format, args...)
+}
+
+// escapeName returns the escape character as it is typed.
+func (f *escapeFilter) escapeName() string {
+	if f.char < 32 {
+		return "^" + string(rune(f.char+64))
+	}
+	return string(rune(f.char))
+}
+
+func (f *escapeFilter) help() {
+	e := f.escapeName()
+	f.printf("Supported escape sequences:\r\n")
+	f.printf(" %s.   - terminate connection\r\n", e)
+	f.printf(" %sB   - send a BREAK to the remote system\r\n", e)
+	f.printf(" %sC   - open a command line\r\n", e)
+	f.printf(" %s^Z  - suspend ssh\r\n", e)
+	f.printf(" %s#   - list forwarded connections\r\n", e)
+	f.printf(" %s?   - this message\r\n", e)
+	f.printf(" %s%s   - send the escape character by typing it twice\r\n", e, e)
+	f.printf("(Note that escapes are only recognized immediately after newline.)\r\n")
+}
+
+func (f *escapeFilter) sendBreak() {
+	payload := ssh.Marshal(struct{ Length uint32 }{breakLength})
+	if _, err := f.session.SendRequest("break", false, payload); err != nil {
+		f.printf("Failed to send break: %v\r\n", err)
+	}
+}
+
+func (f *escapeFilter) listForwards() {
+	var forwards []string
+	if f.forwards != nil {
+		forwards = f.forwards.Describe()
+	}
+	if len(forwards) == 0 {
+		f.printf("No forwarded connections are open.\r\n")
+		return
+	}
+
+	f.printf("The following connections are open:\r\n")
+	for _, line := range forwards {
+		f.printf("  %s\r\n", line)
+	}
+}
+
+// commandLine reads a command from the terminal and runs it. It supports
+// the forwarding options of the ssh command line.
+func (f *escapeFilter) commandLine() {
+	f.printf("\r\nssh> ")
+	line, ok := f.readLine()
+	f.printf("\r\n")
+	if !ok {
+		return
+	}
+
+	if err := f.runCommand(strings.TrimSpace(line)); err != nil {
+		f.printf("%v\r\n", err)
+	}
+}
+
+// readLine reads a line from the terminal, echoing it as it is typed. It
+// returns false if the line was cancelled with ^C.
+func (f *escapeFilter) readLine() (string, bool) {
+	var line []byte
+	for {
+		c, err := f.readByte()
+		if err != nil {
+			return "", false
+		}
+
+		switch {
+		case c == '\r' || c == '\n':
+			return string(line), true
+		case c == 0x03: // ^C
+			return "", false
+		case c == 0x7f || c == 0x08: // Backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				f.printf("\b \b")
+			}
+		case c >= 32:
+			line = append(line, c)
+			f.w.Write([]byte{c})
+		}
+	}
+}
+
+func (f *escapeFilter) runCommand(line string) error {
+	if line == "" {
+		return nil
+	}
+	if line == "?" || line == "-h" {
+		f.printf("Commands:\r\n")
+		f.printf("      -L[bind_address:]port:host:hostport    Request local forward\r\n")
+		f.printf("      -R[bind_address:]port:host:hostport    Request remote forward\r\n")
+		f.printf("      -D[bind_address:]port                  Request dynamic forward\r\n")
+		f.printf("      -KL[bind_address:]port                 Cancel local forward\r\n")
+		f.printf("      -KR[bind_address:]port                 Cancel remote forward\r\n")
+		f.printf("      -KD[bind_address:]port                 Cancel dynamic forward\r\n")
+		return nil
+	}
+
+	if !strings.HasPrefix(line, "-") {
+		return errors.New("invalid command")
+	}
+	line = line[1:]
+
+	cancel := strings.HasPrefix(line, "K")
+	if cancel {
+		line = line[1:]
+	}
+	if line == "" || !strings.ContainsRune("LRD", rune(line[0])) {
+		return errors.New("invalid command")
+	}
+	flag, spec := line[0], strings.TrimSpace(line[1:])
+	if spec == "" {
+		return errors.New("missing forwarding specification")
+	}
+
+	if f.forwards == nil {
+		return errors.New("port forwarding is not available for this connection")
+	}
+	if cancel {
+		return f.forwards.Cancel(flag, spec)
+	}
+	return f.forwards.Add(flag, spec)
+}
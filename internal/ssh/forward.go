@@ -0,0 +1,727 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// forwardKeywords are the config keywords of the forwarding kinds.
+var forwardKeywords = map[byte]string{
+	'L': "LocalForward",
+	'R': "RemoteForward",
+	'D': "DynamicForward",
+}
+
+// Forward is a port forwarding of a connection together with the statistics
+// of the connections it forwarded.
+type Forward struct {
+	Kind   byte              // L for local forwardings, R for remote ones, D for dynamic ones
+	Spec   string            // As given on the ssh command line, such as "8080:db:5432"
+	Option *sshconfig.Option // The config option, nil if added by hand
+
+	listen  forwardAddr
+	connect forwardAddr // Empty for SOCKS proxies
+	auth    *socksAuth  // The SOCKS credentials if not those of the host
+	invalid error       // Why Spec cannot be used
+
+	mu       sync.Mutex
+	listener net.Listener
+	bound    string // The address of the last listener
+	active   int
+	total    int
+	err      error
+}
+
+// forwardAddr is a TCP address or the path of a Unix socket.
+type forwardAddr struct {
+	network string
+	address string
+}
+
+func (a forwardAddr) String() string {
+	if a.network == "" {
+		return "socks"
+	}
+	return a.address
+}
+
+func (f *Forward) String() string {
+	return "-" + string(f.Kind) + " " + f.Spec
+}
+
+// dynamic reports whether the forwarding is a SOCKS proxy, which connects to
+// the address each client asks for. Besides DynamicForward, these are remote
+// forwardings without a target.
+func (f *Forward) dynamic() bool {
+	return f.connect.network == ""
+}
+
+// Listening reports whether the forwarding is accepting connections.
+func (f *Forward) Listening() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.listener != nil
+}
+
+// Addr returns the address the forwarding listens on, or listened on during
+// the last connection, which has the port the server chose for remote
+// forwardings to port 0. It is empty if the forwarding never listened.
+func (f *Forward) Addr() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.bound
+}
+
+// Connections returns the number of open connections and of all connections
+// forwarded so far.
+func (f *Forward) Connections() (active, total int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.active, f.total
+}
+
+// Err returns the last error of the forwarding, or nil if there was none.
+func (f *Forward) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.invalid != nil {
+		return f.invalid
+	}
+	return f.err
+}
+
+// Describe returns a line with the addresses and state of the forwarding.
+func (f *Forward) Describe() string {
+	if f.invalid != nil {
+		return fmt.Sprintf("%s: %v", f, f.invalid)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	listen := f.listen.String()
+	state := "not listening"
+	if f.listener != nil {
+		listen = f.bound
+		state = "listening"
+	}
+	line := fmt.Sprintf("-%c %s -> %s: %s, %d open, %d total", f.Kind, listen, f.connect, state, f.active, f.total)
+	if f.err != nil {
+		line += fmt.Sprintf(", last error: %v", f.err)
+	}
+	return line
+}
+
+func (f *Forward) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Forwards are the port forwardings of a host, those from its config and
+// those added by hand. They are started once connected and keep their
+// statistics when the connection is closed, so they can be shown afterwards
+// and are started again on the next connection.
+type Forwards struct {
+	mu           sync.Mutex
+	list         []*Forward
+	client       *ssh.Client // nil while not connected
+	gatewayPorts bool
+	unlink       bool
+	socks        socksAuth
+	socksErr     error    // Why the SOCKS credentials of the host cannot be used
+	socksWarning string   // Set if the SOCKS password is written into the config
+	warnings     []string // Problems found by the last Start
+}
+
+// NewForwards returns the forwardings configured for host.
+func NewForwards(host *sshconfig.Host) *Forwards {
+	fs := &Forwards{}
+	fs.Configure(host)
+	return fs
+}
+
+// Configure replaces the forwardings from the config with those configured
+// for host. Forwardings added by hand are kept, as are the statistics of
+// configured ones that did not change.
+func (fs *Forwards) Configure(host *sshconfig.Host) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// ClearAllForwardings drops the forwardings of the config files
+	var list []*Forward
+	clearAll := host.Flag("ClearAllForwardings")
+	for _, o := range host.Options {
+		kind, ok := forwardKind(o.Keyword)
+		if !ok || clearAll {
+			continue
+		}
+
+		// The config separates the listen address from the target with a
+		// space, the command line with a colon
+		spec := strings.Join(o.Args, ":")
+		f := fs.find(func(f *Forward) bool {
+			return f.Option != nil && f.Kind == kind && f.Spec == spec &&
+				f.Option.Path == o.Path && f.Option.Line == o.Line
+		})
+		if f == nil {
+			f = newForward(kind, spec)
+			f.Option = &o
+			if err := checkForwardArgs(kind, o.Args); err != nil && f.invalid == nil {
+				f.invalid = err
+			}
+		}
+		list = append(list, f)
+	}
+
+	for _, f := range fs.list {
+		if f.Option == nil {
+			list = append(list, f)
+		}
+	}
+	fs.list = list
+
+	fs.gatewayPorts = host.Flag("GatewayPorts")
+	fs.unlink = host.Flag("StreamLocalBindUnlink")
+	password, err := socksPassword(host)
+	fs.socks = socksAuth{user: host.Get("GosshtSocksUser"), password: password}
+	fs.socksErr = err
+	fs.socksWarning = ""
+	if o, ok := host.Lookup("GosshtSocksPassword"); ok && !strings.HasPrefix(o.Value(), "$") {
+		fs.socksWarning = fmt.Sprintf("the SOCKS password is stored in plaintext in %s line %d, name an environment variable holding it like $PROXY_PASSWORD instead", o.Path, o.Line)
+	}
+}
+
+// socksPassword returns the GosshtSocksPassword of host, which may name an
+// environment variable holding it, like $PROXY_PASSWORD. A variable that is
+// not set is an error, the proxy would accept any password otherwise.
+func socksPassword(host *sshconfig.Host) (string, error) {
+	value := host.Get("GosshtSocksPassword")
+	if !strings.HasPrefix(value, "$") {
+		return value, nil
+	}
+	password := os.Getenv(value[1:])
+	if password == "" {
+		return "", &ConfigError{Keyword: "GosshtSocksPassword", Err: fmt.Errorf("%s is not set", value)}
+	}
+	return password, nil
+}
+
+// checkForwardArgs checks the number of arguments of a forwarding option,
+// which is the listen address followed by the target, or only the listen
+// address for SOCKS proxies.
+func checkForwardArgs(kind byte, args []string) error {
+	switch {
+	case kind == 'D' && len(args) != 1:
+		return fmt.Errorf("%s needs a listen address only", forwardKeywords[kind])
+	case kind == 'L' && len(args) != 2, kind == 'R' && len(args) != 1 && len(args) != 2:
+		return fmt.Errorf("%s needs a listen address and a target", forwardKeywords[kind])
+	}
+	return nil
+}
+
+// forwardKind returns the kind of forwarding configured with keyword.
+func forwardKind(keyword string) (byte, bool) {
+	for kind, k := range forwardKeywords {
+		if k == keyword {
+			return kind, true
+		}
+	}
+	return 0, false
+}
+
+func (fs *Forwards) find(match func(f *Forward) bool) *Forward {
+	for _, f := range fs.list {
+		if match(f) {
+			return f
+		}
+	}
+	return nil
+}
+
+// List returns the forwardings in the order they are started.
+func (fs *Forwards) List() []*Forward {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return append([]*Forward(nil), fs.list...)
+}
+
+// Describe returns a line per forwarding describing its state.
+func (fs *Forwards) Describe() []string {
+	var lines []string
+	for _, f := range fs.List() {
+		lines = append(lines, f.Describe())
+	}
+	return lines
+}
+
+// Add adds a forwarding of the given kind, with spec as on the ssh command
+// line. It is started right away if connected.
+func (fs *Forwards) Add(kind byte, spec string) error {
+	return fs.add(newForward(kind, spec))
+}
+
+// AddDynamic adds a SOCKS proxy like Add with the kind D, which clients have
+// to authenticate to with user and password. Without a user the credentials
+// of the host are used.
+func (fs *Forwards) AddDynamic(spec, user, password string) error {
+	f := newForward('D', spec)
+	if user != "" {
+		f.auth = &socksAuth{user: user, password: password}
+	}
+	return fs.add(f)
+}
+
+func (fs *Forwards) add(f *Forward) error {
+	if f.invalid != nil {
+		return f.invalid
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.find(func(o *Forward) bool { return o.Kind == f.Kind && o.Spec == f.Spec }) != nil {
+		return fmt.Errorf("%s is already set up", f)
+	}
+	if fs.client != nil {
+		if err := fs.start(f); err != nil {
+			return err
+		}
+	}
+	fs.list = append(fs.list, f)
+	return nil
+}
+
+// Remove stops f and removes it if it was added by hand.
+func (fs *Forwards) Remove(f *Forward) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	f.stop()
+	if f.Option != nil {
+		return
+	}
+	for i, o := range fs.list {
+		if o == f {
+			fs.list = append(fs.list[:i], fs.list[i+1:]...)
+			break
+		}
+	}
+}
+
+// Cancel stops the forwarding of the given kind that listens on spec, which
+// is "[bind_address:]port" or the path of a Unix socket, like the ssh escape
+// command line does.
+func (fs *Forwards) Cancel(kind byte, spec string) error {
+	host, port := "", spec
+	if !strings.HasPrefix(spec, "/") {
+		fields, err := splitForwardSpec(spec)
+		if err != nil || len(fields) > 2 {
+			return fmt.Errorf("bad forwarding close specification %q", spec)
+		}
+		if len(fields) == 2 {
+			host = fields[0]
+		}
+		port = fields[len(fields)-1]
+	}
+
+	fs.mu.Lock()
+	f := fs.find(func(f *Forward) bool {
+		if f.Kind != kind || f.invalid != nil || !f.Listening() {
+			return false
+		}
+		if f.listen.network == "unix" {
+			return f.listen.address == port
+		}
+		// Remote forwardings to port 0 are cancelled with the port the server
+		// chose
+		h, _, _ := net.SplitHostPort(f.listen.address)
+		_, p, _ := net.SplitHostPort(f.Addr())
+		return p == port && (host == "" || h == host)
+	})
+	fs.mu.Unlock()
+	if f == nil {
+		return fmt.Errorf("unknown forwarding -%c %s", kind, spec)
+	}
+
+	fs.Remove(f)
+	return nil
+}
+
+// Start starts every valid forwarding over client. Forwardings that cannot
+// listen are reported by their Err and Warnings and skipped, unless
+// exitOnFailure is set, in which case the first error is returned.
+func (fs *Forwards) Start(client *ssh.Client, exitOnFailure bool) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.client = client
+	fs.warnings = nil
+	for _, f := range fs.list {
+		err := f.invalid
+		if err == nil {
+			err = fs.start(f)
+		}
+		if err != nil && exitOnFailure {
+			return err
+		}
+		if err != nil {
+			fs.warnings = append(fs.warnings, err.Error())
+		}
+	}
+	return nil
+}
+
+// Warnings returns the forwardings the last Start skipped and why, and
+// whether the SOCKS password of the host is written into the config file.
+func (fs *Forwards) Warnings() []string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	warnings := append([]string(nil), fs.warnings...)
+	if fs.socksWarning != "" {
+		warnings = append(warnings, fs.socksWarning)
+	}
+	return warnings
+}
+
+// Stop stops listening for new connections. Connections that are still open
+// end with the client.
+func (fs *Forwards) Stop() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.client = nil
+	for _, f := range fs.list {
+		f.stop()
+	}
+}
+
+// start listens for the connections of f. SOCKS proxies are not started
+// without credentials if those of the host cannot be used.
+func (fs *Forwards) start(f *Forward) error {
+	auth := f.auth
+	if auth == nil && f.dynamic() && fs.socksErr != nil {
+		err := fmt.Errorf("%s: %w", f, fs.socksErr)
+		f.fail(err)
+		return err
+	}
+	if auth == nil {
+		socks := fs.socks
+		auth = &socks
+	}
+
+	// Local forwardings connect from the server, remote ones from here
+	var err error
+	switch f.Kind {
+	case 'L', 'D':
+		err = f.listenLocal(f.opener(fs.client.Dial, auth), fs.gatewayPorts, fs.unlink)
+	case 'R':
+		err = f.listenRemote(fs.client, f.opener(net.Dial, auth))
+	default:
+		err = fmt.Errorf("-%c forwarding is not supported", f.Kind)
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", f, err)
+		f.fail(err)
+	}
+	return err
+}
+
+func (f *Forward) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.listener != nil {
+		f.listener.Close()
+		f.listener = nil
+	}
+}
+
+// opener returns how the other end of a connection accepted by f is opened
+// with dial, which connects to the target or, for SOCKS proxies, to the
+// address the client asks for.
+func (f *Forward) opener(dial func(network, address string) (net.Conn, error), auth *socksAuth) func(conn net.Conn) (net.Conn, error) {
+	if f.dynamic() {
+		return func(conn net.Conn) (net.Conn, error) {
+			return socksServe(conn, auth, dial)
+		}
+	}
+	return func(net.Conn) (net.Conn, error) {
+		return dial(f.connect.network, f.connect.address)
+	}
+}
+
+// listenLocal listens on the local address of f and forwards every
+// connection to the other end opened by open.
+func (f *Forward) listenLocal(open func(conn net.Conn) (net.Conn, error), gatewayPorts, unlink bool) error {
+	address := f.listen.address
+	if f.listen.network == "tcp" {
+		address = bindAddress(address, gatewayPorts)
+	} else if unlink {
+		os.Remove(address)
+	}
+
+	l, err := net.Listen(f.listen.network, address)
+	if err != nil {
+		return err
+	}
+
+	f.serve(l, open)
+	return nil
+}
+
+// listenRemote asks the server to listen on the remote address of f and
+// forwards every connection to the other end opened by open.
+func (f *Forward) listenRemote(client *ssh.Client, open func(conn net.Conn) (net.Conn, error)) error {
+	var l net.Listener
+	var err error
+	if f.listen.network == "unix" {
+		l, err = client.ListenUnix(f.listen.address)
+	} else {
+		var addr *net.TCPAddr
+		if addr, err = remoteBindAddress(f.listen.address); err == nil {
+			l, err = client.ListenTCP(addr)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	f.serve(l, open)
+	return nil
+}
+
+// serve forwards the connections accepted by l to the connections opened by
+// open until l is closed.
+func (f *Forward) serve(l net.Listener, open func(conn net.Conn) (net.Conn, error)) {
+	f.mu.Lock()
+	f.listener = l
+	f.bound = l.Addr().String()
+	f.err = nil
+	f.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.forward(conn, open)
+		}
+	}()
+}
+
+// bindAddress returns the address to listen on for a forwarding. Without a
+// bind address only connections from this machine are accepted, unless
+// GatewayPorts is set, and "*" means every interface.
+func bindAddress(address string, gatewayPorts bool) string {
+	host, port, _ := net.SplitHostPort(address)
+	switch host {
+	case "":
+		if !gatewayPorts {
+			host = "localhost"
+		}
+	case "*":
+		host = ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// remoteBindAddress returns the address to ask the server to listen on for a
+// remote forwarding. Like with OpenSSH, the server listens on the loopback
+// interface without a bind address and on every interface for "*", if its
+// GatewayPorts allows. The server is sent an IP address, which the client
+// needs to match the connections it forwards.
+func remoteBindAddress(address string) (*net.TCPAddr, error) {
+	host, port, _ := net.SplitHostPort(address)
+	switch host {
+	case "":
+		host = "127.0.0.1"
+	case "*":
+		host = "0.0.0.0"
+	}
+	return net.ResolveTCPAddr("tcp", net.JoinHostPort(host, port))
+}
+
+// forward opens the other end of conn with open and copies between both
+// until they are closed.
+func (f *Forward) forward(conn net.Conn, open func(conn net.Conn) (net.Conn, error)) {
+	other, err := open(conn)
+	if err != nil {
+		conn.Close()
+		f.fail(err)
+		return
+	}
+
+	f.mu.Lock()
+	f.active++
+	f.total++
+	f.mu.Unlock()
+
+	pipe(conn, other)
+
+	f.mu.Lock()
+	f.active--
+	f.mu.Unlock()
+}
+
+// pipe copies between a and b in both directions and closes both once done.
+// The end of the input of one side is passed on to the other where the
+// connection supports closing only its write half.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if c, ok := dst.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+
+	a.Close()
+	b.Close()
+}
+
+// newForward parses spec as given on the ssh command line for the forwarding
+// kind. Invalid specs are recorded in the invalid field.
+func newForward(kind byte, spec string) *Forward {
+	f := &Forward{Kind: kind, Spec: spec}
+	if _, ok := forwardKeywords[kind]; !ok {
+		f.invalid = fmt.Errorf("unknown forwarding -%c", kind)
+		return f
+	}
+
+	// Only the server can choose a port to listen on, and remote forwardings
+	// without a target are SOCKS proxies
+	fields, err := splitForwardSpec(spec)
+	if err == nil && kind == 'D' {
+		f.listen, err = parseListenFields(fields, false)
+	} else if err == nil {
+		f.listen, f.connect, err = parseForwardFields(fields, kind == 'R')
+		if err != nil && kind == 'R' {
+			if listen, dynErr := parseListenFields(fields, true); dynErr == nil {
+				f.listen, f.connect, err = listen, forwardAddr{}, nil
+			}
+		}
+	}
+	if err != nil {
+		f.invalid = fmt.Errorf("bad forwarding specification %q: %w", spec, err)
+	}
+	return f
+}
+
+// parseForwardFields returns the listen and connect addresses of a forwarding
+// that has the forms
+//
+//	[bind_address:]port:host:hostport
+//	[bind_address:]port:socket
+//	socket:host:hostport
+//	socket:socket
+//
+// where the first address is listened on and sockets are absolute paths. The
+// listen port may be 0 if anyPort is set.
+func parseForwardFields(fields []string, anyPort bool) (listen, connect forwardAddr, err error) {
+	isPath := func(i int) bool {
+		return strings.HasPrefix(fields[i], "/")
+	}
+
+	switch {
+	case len(fields) == 2 && isPath(0) && isPath(1):
+		return unixAddr(fields[0]), unixAddr(fields[1]), nil
+	case len(fields) == 2 && isPath(1):
+		listen, err = tcpAddr("", fields[0], anyPort)
+		return listen, unixAddr(fields[1]), err
+	case len(fields) == 3 && isPath(0):
+		connect, err = tcpAddr(fields[1], fields[2], false)
+		return unixAddr(fields[0]), connect, err
+	case len(fields) == 3 && isPath(2):
+		listen, err = tcpAddr(fields[0], fields[1], anyPort)
+		return listen, unixAddr(fields[2]), err
+	case len(fields) == 3:
+		fields = append([]string{""}, fields...)
+		fallthrough
+	case len(fields) == 4:
+		if listen, err = tcpAddr(fields[0], fields[1], anyPort); err != nil {
+			return listen, connect, err
+		}
+		connect, err = tcpAddr(fields[2], fields[3], false)
+		return listen, connect, err
+	}
+	return listen, connect, errors.New("wrong number of fields")
+}
+
+// parseListenFields returns the address of a SOCKS proxy that has the forms
+// [bind_address:]port or socket.
+func parseListenFields(fields []string, anyPort bool) (forwardAddr, error) {
+	switch {
+	case len(fields) == 1 && strings.HasPrefix(fields[0], "/"):
+		return unixAddr(fields[0]), nil
+	case len(fields) == 1:
+		return tcpAddr("", fields[0], anyPort)
+	case len(fields) == 2:
+		return tcpAddr(fields[0], fields[1], anyPort)
+	}
+	return forwardAddr{}, errors.New("wrong number of fields")
+}
+
+func unixAddr(path string) forwardAddr {
+	return forwardAddr{network: "unix", address: path}
+}
+
+// tcpAddr returns the TCP address of host and port, where port 0 is only
+// allowed if allowZero is set.
+func tcpAddr(host, port string, allowZero bool) (forwardAddr, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 || (n == 0 && !allowZero) {
+		return forwardAddr{}, fmt.Errorf("bad port %q", port)
+	}
+	return forwardAddr{network: "tcp", address: net.JoinHostPort(host, port)}, nil
+}
+
+// splitForwardSpec splits spec at colons, except those of IPv6 addresses
+// in square brackets.
+func splitForwardSpec(spec string) ([]string, error) {
+	var fields []string
+	for {
+		var field string
+		if strings.HasPrefix(spec, "[") {
+			end := strings.IndexByte(spec, ']')
+			if end < 0 {
+				return nil, errors.New("missing ]")
+			}
+			field, spec = spec[1:end], spec[end+1:]
+			if spec != "" && spec[0] != ':' {
+				return nil, errors.New("missing : after ]")
+			}
+		} else {
+			end := strings.IndexByte(spec, ':')
+			if end < 0 {
+				end = len(spec)
+			}
+			field, spec = spec[:end], spec[end:]
+		}
+		fields = append(fields, field)
+
+		if spec == "" {
+			return fields, nil
+		}
+		spec = spec[1:]
+	}
+}
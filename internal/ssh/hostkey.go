@@ -0,0 +1,257 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	defaultUserKnownHostsFiles   = []string{"~/.ssh/known_hosts", "~/.ssh/known_hosts2"}
+	defaultGlobalKnownHostsFiles = []string{"/etc/ssh/ssh_known_hosts", "/etc/ssh/ssh_known_hosts2"}
+)
+
+// defaultHostKeyAlgorithms are the host key algorithms supported by
+// golang.org/x/crypto/ssh in its order of preference.
+var defaultHostKeyAlgorithms = []string{
+	ssh.CertAlgoRSASHA256v01, ssh.CertAlgoRSASHA512v01,
+	ssh.CertAlgoRSAv01, ssh.CertAlgoDSAv01, ssh.CertAlgoECDSA256v01,
+	ssh.CertAlgoECDSA384v01, ssh.CertAlgoECDSA521v01, ssh.CertAlgoED25519v01,
+
+	ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSA, ssh.KeyAlgoDSA,
+
+	ssh.KeyAlgoED25519,
+}
+
+// HostKeyMismatchError is returned if the host key of a server differs from
+// the one in the known hosts files, which could mean that someone is
+// intercepting the connection.
+type HostKeyMismatchError struct {
+	Host  string
+	Key   ssh.PublicKey
+	Known []knownhosts.KnownKey
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key for %s has changed to %s %s", e.Host, e.Key.Type(), ssh.FingerprintSHA256(e.Key))
+}
+
+// UnknownHostKeyError is returned if the host key of a server is not known and
+// StrictHostKeyChecking does not allow adding it.
+type UnknownHostKeyError struct {
+	Host string
+	Key  ssh.PublicKey
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("no %s host key is known for %s and StrictHostKeyChecking is enabled", e.Key.Type(), e.Host)
+}
+
+// hostKeyVerifier checks the host key of a server against the known hosts
+// files of a host. Depending on StrictHostKeyChecking, unknown keys are
+// refused, accepted or accepted after asking the user, and then added to the
+// user's known hosts file.
+type hostKeyVerifier struct {
+	address   string // The name of the host in the known hosts files, with port
+	strict    string
+	hash      bool
+	userFiles []string
+	known     ssh.HostKeyCallback // nil if no known hosts file exists
+	prompter  Prompter
+}
+
+// newHostKeyVerifier reads the known hosts files of host. Files that do not
+// exist are skipped.
+func newHostKeyVerifier(host *sshconfig.Host, target *Target, prompter Prompter) (*hostKeyVerifier, error) {
+	v := &hostKeyVerifier{
+		address:  target.Addr(),
+		strict:   strings.ToLower(host.Get("StrictHostKeyChecking")),
+		hash:     host.Flag("HashKnownHosts"),
+		prompter: prompter,
+	}
+
+	// Keys are stored for the alias without port
+	if alias := host.Get("HostKeyAlias"); alias != "" {
+		v.address = net.JoinHostPort(alias, "22")
+	}
+	if host.Flag("BatchMode") {
+		v.prompter = nil
+	}
+
+	v.userFiles = knownHostsFiles(host, "UserKnownHostsFile", defaultUserKnownHostsFiles)
+	files := append(knownHostsFiles(host, "GlobalKnownHostsFile", defaultGlobalKnownHostsFiles), v.userFiles...)
+
+	var existing []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			existing = append(existing, f)
+		}
+	}
+	if len(existing) > 0 {
+		known, err := knownhosts.New(existing...)
+		if err != nil {
+			return nil, err
+		}
+		v.known = known
+	}
+
+	return v, nil
+}
+
+// knownHostsFiles returns the expanded paths of the known hosts files set
+// with keyword, or defaults if it is not set.
+func knownHostsFiles(host *sshconfig.Host, keyword string, defaults []string) []string {
+	files := defaults
+	if o, ok := host.Lookup(keyword); ok {
+		files = o.Args
+	}
+
+	tokens := host.Tokens()
+	var paths []string
+	for _, f := range files {
+		if strings.EqualFold(f, "none") {
+			continue
+		}
+		paths = append(paths, sshconfig.ExpandPath(tokens.Expand(f)))
+	}
+	return paths
+}
+
+// check is the ssh.HostKeyCallback of the verifier.
+func (v *hostKeyVerifier) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	var keyErr *knownhosts.KeyError
+	err := v.lookup(key)
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+
+	// Any known key for the host means the server presented a different one
+	host := knownhosts.Normalize(v.address)
+	if len(keyErr.Want) > 0 {
+		return &HostKeyMismatchError{Host: host, Key: key, Known: keyErr.Want}
+	}
+
+	switch v.strict {
+	case "yes", "true":
+		return &UnknownHostKeyError{Host: host, Key: key}
+	case "no", "false", "off", "accept-new":
+	default:
+		if v.prompter == nil {
+			return &UnknownHostKeyError{Host: host, Key: key}
+		}
+		ok, err := v.prompter.ConfirmHostKey(host, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrCancelled
+		}
+	}
+
+	// Like OpenSSH, failing to remember the key does not stop the connection
+	v.add(key)
+	return nil
+}
+
+// lookup checks key against the known hosts files. It returns a
+// *knownhosts.KeyError if the key is not known.
+func (v *hostKeyVerifier) lookup(key ssh.PublicKey) error {
+	if v.known == nil {
+		return &knownhosts.KeyError{}
+	}
+
+	// Only the host name is checked, which connections through a proxy do
+	// not have a TCP address for
+	return v.known(v.address, &net.TCPAddr{}, key)
+}
+
+// knownKeys returns the keys known for the host.
+func (v *hostKeyVerifier) knownKeys() []knownhosts.KnownKey {
+	// A key that cannot be known makes the lookup list the known ones
+	_, random, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	signer, err := ssh.NewSignerFromKey(random)
+	if err != nil {
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if errors.As(v.lookup(signer.PublicKey()), &keyErr) {
+		return keyErr.Want
+	}
+	return nil
+}
+
+// algorithms returns the host key algorithms to negotiate, preferring the
+// types of the known keys so a server with several keys presents a known one.
+func (v *hostKeyVerifier) algorithms() []string {
+	var preferred []string
+	for _, k := range v.knownKeys() {
+		switch k.Key.Type() {
+		case ssh.KeyAlgoRSA:
+			preferred = append(preferred, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSA)
+		default:
+			preferred = append(preferred, k.Key.Type())
+		}
+	}
+	if len(preferred) == 0 {
+		return nil
+	}
+
+	algorithms := preferred
+	for _, a := range defaultHostKeyAlgorithms {
+		if !slices.Contains(algorithms, a) {
+			algorithms = append(algorithms, a)
+		}
+	}
+	return algorithms
+}
+
+// add appends key to the first user known hosts file, hashing the host name
+// if HashKnownHosts is set.
+func (v *hostKeyVerifier) add(key ssh.PublicKey) error {
+	if len(v.userFiles) == 0 {
+		return nil
+	}
+	path := v.userFiles[0]
+
+	host := knownhosts.Normalize(v.address)
+	if v.hash {
+		host = knownhosts.HashHostname(host)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Start on a new line if the file does not end with one
+	line := knownhosts.Line([]string{host}, key) + "\n"
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = "\n" + line
+		}
+	}
+
+	_, err = f.WriteString(line)
+	return err
+}
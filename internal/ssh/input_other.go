@@ -0,0 +1,14 @@
+//go:build !unix
+
+package ssh
+
+import (
+	"io"
+	"os"
+)
+
+// openInput returns os.Stdin for reading the input of a session, as the
+// terminal cannot be opened separately on this platform.
+func openInput() io.ReadCloser {
+	return io.NopCloser(os.Stdin)
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package ssh
+
+import (
+	"io"
+	"os"
+)
+
+// openInput opens the terminal for reading the input of a session. Unlike
+// os.Stdin, closing it interrupts a pending read, so the reader of the
+// session does not linger and swallow the next key pressed once the session
+// has ended.
+func openInput() io.ReadCloser {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return io.NopCloser(os.Stdin)
+	}
+	return tty
+}
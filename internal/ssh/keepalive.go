@@ -0,0 +1,95 @@
+package ssh
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultServerAliveCountMax is how many keepalives may go unanswered if a
+// host has no ServerAliveCountMax.
+const defaultServerAliveCountMax = 3
+
+// ErrConnectionLost is returned if the server stopped answering keepalives.
+var ErrConnectionLost = errors.New("connection lost")
+
+// keepAlive sends keepalive requests to the server of a client and closes the
+// client once too many of them went unanswered.
+type keepAlive struct {
+	client   *ssh.Client
+	interval time.Duration
+	countMax int
+
+	missed atomic.Int32
+	lost   atomic.Bool
+	done   chan struct{}
+}
+
+// startKeepAlive starts sending keepalives on client every ServerAliveInterval
+// of host. It returns nil if keepalives are disabled.
+func startKeepAlive(client *ssh.Client, host *sshconfig.Host) *keepAlive {
+	interval, err := sshconfig.ParseTime(host.Get("ServerAliveInterval"))
+	if err != nil || interval <= 0 {
+		return nil
+	}
+
+	countMax := defaultServerAliveCountMax
+	if n, err := strconv.Atoi(host.Get("ServerAliveCountMax")); err == nil {
+		countMax = n
+	}
+
+	k := &keepAlive{
+		client:   client,
+		interval: interval,
+		countMax: countMax,
+		done:     make(chan struct{}),
+	}
+	go k.run()
+
+	return k
+}
+
+func (k *keepAlive) run() {
+	ticker := time.NewTicker(k.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Like OpenSSH, give up once more than ServerAliveCountMax requests
+		// are waiting for an answer
+		if int(k.missed.Add(1)) > k.countMax {
+			k.lost.Store(true)
+			k.client.Close()
+			return
+		}
+
+		// A dead server never answers, so do not wait for it here
+		go func() {
+			if _, _, err := k.client.SendRequest("keepalive@openssh.com", true, nil); err == nil {
+				k.missed.Store(0)
+			}
+		}()
+	}
+}
+
+// Stop stops sending keepalives.
+func (k *keepAlive) Stop() {
+	if k != nil {
+		close(k.done)
+	}
+}
+
+// Lost reports whether the connection was closed because the server stopped
+// answering.
+func (k *keepAlive) Lost() bool {
+	return k != nil && k.lost.Load()
+}
@@ -0,0 +1,224 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxJumpDepth limits how deeply jump hosts may use ProxyJump themselves, so
+// hosts that jump through each other cannot loop forever.
+const maxJumpDepth = 8
+
+// jumpHost is a hop of a ProxyJump chain, written as [user@]host[:port] or
+// ssh://[user@]host[:port].
+type jumpHost struct {
+	User string
+	Host string
+	Port int
+}
+
+// parseProxyJump parses the comma separated hops of a ProxyJump value. It
+// returns no hops for "none".
+func parseProxyJump(value string) ([]jumpHost, error) {
+	if value == "" || strings.EqualFold(value, "none") {
+		return nil, nil
+	}
+
+	var jumps []jumpHost
+	for _, spec := range strings.Split(value, ",") {
+		j, err := parseJumpHost(strings.TrimSpace(spec))
+		if err != nil {
+			return nil, &ConfigError{Keyword: "ProxyJump", Err: fmt.Errorf("%q: %w", spec, err)}
+		}
+		jumps = append(jumps, j)
+	}
+	return jumps, nil
+}
+
+func parseJumpHost(spec string) (jumpHost, error) {
+	var j jumpHost
+
+	s := strings.TrimPrefix(spec, "ssh://")
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		j.User, s = s[:i], s[i+1:]
+	}
+
+	j.Host = s
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		j.Port, err = strconv.Atoi(port)
+		if err != nil || j.Port < 1 || j.Port > 65535 {
+			return j, fmt.Errorf("invalid port %q", port)
+		}
+		j.Host = host
+	}
+	j.Host = strings.TrimSuffix(strings.TrimPrefix(j.Host, "["), "]")
+
+	if j.Host == "" {
+		return j, errors.New("missing host")
+	}
+	return j, nil
+}
+
+// proxyOption returns the ProxyJump or ProxyCommand option of host. Like
+// OpenSSH, whichever of the two is set first is used and the other ignored.
+func proxyOption(host *sshconfig.Host) (sshconfig.Option, bool) {
+	for _, o := range host.Options {
+		if o.Keyword == "ProxyJump" || o.Keyword == "ProxyCommand" {
+			return o, true
+		}
+	}
+	return sshconfig.Option{}, false
+}
+
+// dialer connects to hosts, tunnelling through the jump hosts configured
+// with ProxyJump. Jump hosts are resolved through the same config files as
+// the target.
+type dialer struct {
+	resolver *sshconfig.Resolver
+	prompter Prompter
+}
+
+// connect connects to host and authenticates. If via is nil, the connection
+// goes through the ProxyJump chain or the ProxyCommand of host, otherwise it
+// is tunnelled through via, which is closed together with the returned
+// client.
+func (d *dialer) connect(host *sshconfig.Host, via *ssh.Client, depth int) (*ssh.Client, error) {
+	host = host.WithDefaults()
+	target := NewTarget(host)
+
+	agentClient, agentConn := SSHAgent(host)
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+	attempts := &authAttempts{}
+	conf, err := clientConfig(host, target, agentClient, d.prompter, attempts)
+	if err != nil {
+		if via != nil {
+			via.Close()
+		}
+		return nil, err
+	}
+
+	var command string
+	if proxy, ok := proxyOption(host); ok && via == nil {
+		switch proxy.Keyword {
+		case "ProxyJump":
+			jumps, err := parseProxyJump(proxy.Value())
+			if err != nil {
+				return nil, err
+			}
+			if len(jumps) > 0 {
+				if via, err = d.jump(jumps, depth); err != nil {
+					return nil, err
+				}
+			}
+		case "ProxyCommand":
+			if !strings.EqualFold(proxy.Value(), "none") {
+				command = host.Tokens().Expand(proxy.Command())
+			}
+		}
+	}
+
+	var client *ssh.Client
+	switch {
+	case command != "":
+		client, err = dialCommand(command, target, conf)
+	case via == nil:
+		client, err = dial(target, conf)
+	default:
+		if client, err = dialVia(via, target, conf); err != nil {
+			via.Close()
+		}
+	}
+
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		authErr.Methods = attempts.list()
+	}
+	if err != nil || via == nil {
+		return client, err
+	}
+
+	// Close the jump hosts once the connection through them has ended
+	go func() {
+		client.Wait()
+		via.Close()
+	}()
+
+	return client, nil
+}
+
+// jump connects to each of the jump hosts through the previous one and
+// returns the client of the last. Only the first jump host may use a
+// ProxyJump of its own.
+func (d *dialer) jump(jumps []jumpHost, depth int) (*ssh.Client, error) {
+	if depth >= maxJumpDepth {
+		return nil, &ConfigError{Keyword: "ProxyJump", Err: errors.New("too many nested jump hosts")}
+	}
+
+	var via *ssh.Client
+	for _, j := range jumps {
+		host, err := d.resolveJump(j)
+		if err != nil {
+			if via != nil {
+				via.Close()
+			}
+			return nil, &ProxyJumpError{Jump: j.Host, Err: err}
+		}
+
+		client, err := d.connect(host, via, depth+1)
+		if err != nil {
+			return nil, &ProxyJumpError{Jump: j.Host, Err: err}
+		}
+		via = client
+	}
+
+	return via, nil
+}
+
+// resolveJump returns the options for the jump host j, where a user or port
+// given in the ProxyJump value takes precedence over the config files.
+func (d *dialer) resolveJump(j jumpHost) (*sshconfig.Host, error) {
+	resolver := d.resolver
+	if resolver == nil {
+		resolver = &sshconfig.Resolver{}
+	}
+
+	host, err := resolver.Resolve(j.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	if j.User != "" {
+		host = host.Override("User", j.User)
+	}
+	if j.Port != 0 {
+		host = host.Override("Port", strconv.Itoa(j.Port))
+	}
+	return host, nil
+}
+
+// dialVia opens a connection to target through the jump host via and
+// performs the SSH handshake over it. The host name is resolved by the jump
+// host.
+func dialVia(via *ssh.Client, target *Target, conf *ssh.ClientConfig) (*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), target.ConnectTimeout)
+	defer cancel()
+
+	conn, err := via.DialContext(ctx, "tcp", target.Addr())
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, &TimeoutError{Addr: target.Addr(), Timeout: target.ConnectTimeout, Err: err}
+	}
+	if err != nil {
+		return nil, &ChannelError{Op: "open a connection to " + target.Addr() + " through the jump host", Err: err}
+	}
+
+	return handshake(conn, target, conf)
+}
@@ -0,0 +1,176 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+	"golang.org/x/crypto/ssh"
+)
+
+// maxProxyStderr is how much of the most recent output of a ProxyCommand on
+// stderr is kept for error messages.
+const maxProxyStderr = 4096
+
+// ProxyCommandError is returned if connecting through a ProxyCommand fails.
+// It carries what the command wrote to stderr, which usually explains why.
+type ProxyCommandError struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (e *ProxyCommandError) Error() string {
+	msg := fmt.Sprintf("proxy command %q: %v", e.Command, e.Err)
+	if e.Stderr != "" {
+		msg += "\n\n" + e.Stderr
+	}
+	return msg
+}
+
+func (e *ProxyCommandError) Unwrap() error {
+	return e.Err
+}
+
+// dialCommand starts command and performs the SSH handshake with target over
+// its standard input and output.
+func dialCommand(command string, target *Target, conf *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := startProxyCommand(command)
+	if err != nil {
+		return nil, &ProxyCommandError{Command: command, Err: err}
+	}
+
+	client, err := handshake(conn, target, conf)
+	if err != nil {
+		// Failing to authenticate is not the fault of the command
+		if authenticating(err) {
+			return nil, err
+		}
+		// The command has exited once the connection is closed, so all of
+		// its output is there
+		return nil, &ProxyCommandError{Command: command, Stderr: conn.stderr.String(), Err: err}
+	}
+
+	return client, nil
+}
+
+// commandConn is a connection to a ProxyCommand over its standard input and
+// output.
+type commandConn struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	stdout  io.ReadCloser
+	stderr  *tailBuffer
+
+	closeOnce sync.Once
+}
+
+func startProxyCommand(command string) (*commandConn, error) {
+	// Replace the shell with the command so closing the connection ends it
+	shellCommand := command
+	if runtime.GOOS != "windows" {
+		shellCommand = "exec " + command
+	}
+
+	cmd := sshconfig.ShellCommand(context.Background(), shellCommand)
+
+	c := &commandConn{command: command, cmd: cmd, stderr: &tailBuffer{max: maxProxyStderr}}
+	cmd.Stderr = c.stderr
+
+	var err error
+	if c.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if c.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *commandConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *commandConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close ends the command and waits for it to exit.
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr {
+	return commandAddr(c.command)
+}
+
+func (c *commandConn) RemoteAddr() net.Addr {
+	return commandAddr(c.command)
+}
+
+func (c *commandConn) SetDeadline(t time.Time) error {
+	return errors.New("proxy command: deadline not supported")
+}
+
+func (c *commandConn) SetReadDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+func (c *commandConn) SetWriteDeadline(t time.Time) error {
+	return c.SetDeadline(t)
+}
+
+// commandAddr is the address of a connection to a ProxyCommand.
+type commandAddr string
+
+func (a commandAddr) Network() string {
+	return "proxy"
+}
+
+func (a commandAddr) String() string {
+	return string(a)
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+	max int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+// String returns the kept output without surrounding whitespace.
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(bytes.TrimSpace(b.buf))
+}
@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// The size of the randomart field, the same as OpenSSH uses.
+const (
+	randomArtWidth  = 17
+	randomArtHeight = 9
+)
+
+// randomArtSymbols are the characters for how often a field was visited,
+// followed by those marking the start and end position.
+const randomArtSymbols = " .o+=*BOX@%&#/^SE"
+
+// RandomArt returns the visual host key of key as drawn by OpenSSH's
+// VisualHostKey, computed from its SHA256 fingerprint.
+func RandomArt(key ssh.PublicKey) string {
+	var field [randomArtWidth][randomArtHeight]int
+	end := len(randomArtSymbols) - 1
+
+	x, y := randomArtWidth/2, randomArtHeight/2
+	digest := sha256.Sum256(key.Marshal())
+	for _, input := range digest {
+		// Each pair of bits moves the bishop diagonally
+		for b := 0; b < 4; b++ {
+			if input&0x1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if input&0x2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = max(0, min(x, randomArtWidth-1))
+			y = max(0, min(y, randomArtHeight-1))
+
+			if field[x][y] < end-2 {
+				field[x][y]++
+			}
+			input >>= 2
+		}
+	}
+	field[randomArtWidth/2][randomArtHeight/2] = end - 1
+	field[x][y] = end
+
+	var b strings.Builder
+	b.WriteString(randomArtBorder(keyTitle(key)) + "\n")
+	for y := 0; y < randomArtHeight; y++ {
+		b.WriteByte('|')
+		for x := 0; x < randomArtWidth; x++ {
+			b.WriteByte(randomArtSymbols[field[x][y]])
+		}
+		b.WriteString("|\n")
+	}
+	b.WriteString(randomArtBorder("[SHA256]"))
+
+	return b.String()
+}
+
+// randomArtBorder returns a horizontal border with title centered in it.
+func randomArtBorder(title string) string {
+	if len(title) > randomArtWidth {
+		title = ""
+	}
+	left := (randomArtWidth - len(title)) / 2
+	right := randomArtWidth - len(title) - left
+	return "+" + strings.Repeat("-", left) + title + strings.Repeat("-", right) + "+"
+}
+
+// keyTitle returns the type and size of key in the format OpenSSH puts at the
+// top of the randomart, such as "[ED25519 256]".
+func keyTitle(key ssh.PublicKey) string {
+	name := keyTypeName(key.Type())
+
+	bits := 0
+	if ck, ok := key.(ssh.CryptoPublicKey); ok {
+		switch k := ck.CryptoPublicKey().(type) {
+		case *rsa.PublicKey:
+			bits = k.N.BitLen()
+		case *ecdsa.PublicKey:
+			bits = k.Curve.Params().BitSize
+		case ed25519.PublicKey:
+			bits = 256
+		case *dsa.PublicKey:
+			bits = k.P.BitLen()
+		}
+	}
+
+	title := fmt.Sprintf("[%s %d]", name, bits)
+	if bits == 0 || len(title) > randomArtWidth+1 {
+		title = "[" + name + "]"
+	}
+	return title
+}
+
+// keyTypeName returns the short name OpenSSH uses for a key type.
+func keyTypeName(keyType string) string {
+	switch {
+	case keyType == ssh.KeyAlgoRSA:
+		return "RSA"
+	case keyType == ssh.KeyAlgoDSA:
+		return "DSA"
+	case keyType == ssh.KeyAlgoED25519:
+		return "ED25519"
+	case keyType == ssh.KeyAlgoSKED25519:
+		return "ED25519-SK"
+	case keyType == ssh.KeyAlgoSKECDSA256:
+		return "ECDSA-SK"
+	case strings.HasPrefix(keyType, "ecdsa-sha2-"):
+		return "ECDSA"
+	}
+	return strings.ToUpper(keyType)
+}
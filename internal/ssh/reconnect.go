@@ -0,0 +1,92 @@
+package ssh
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+const (
+	// minReconnectDelay is the wait before the first reconnect attempt, it
+	// doubles with every failed attempt up to maxReconnectDelay.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// ReconnectPolicy describes how a host is reconnected after its connection
+// dropped. It is configured with the gossht specific keywords
+// GosshtReconnect, which is "yes" or the maximum number of attempts, and
+// GosshtReconnectCommand, the remote command to run instead of a shell once
+// reconnected.
+type ReconnectPolicy struct {
+	MaxAttempts int // 0 means no limit
+	Command     sshconfig.Option
+}
+
+// NewReconnectPolicy returns the reconnect policy of host, or nil if host
+// should not be reconnected.
+func NewReconnectPolicy(host *sshconfig.Host) *ReconnectPolicy {
+	value := strings.ToLower(host.Get("GosshtReconnect"))
+
+	p := &ReconnectPolicy{}
+	switch value {
+	case "yes", "true":
+	default:
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil
+		}
+		p.MaxAttempts = n
+	}
+
+	p.Command, _ = host.Lookup("GosshtReconnectCommand")
+	return p
+}
+
+// Delay returns how long to wait before the given attempt, counting from 1.
+func (p *ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := minReconnectDelay
+	for i := 1; i < attempt && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxReconnectDelay)
+}
+
+// Exhausted reports whether no attempts are left after the given one.
+func (p *ReconnectPolicy) Exhausted(attempt int) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// Host returns the options for reconnecting to host, which run the reconnect
+// command if there is one.
+func (p *ReconnectPolicy) Host(host *sshconfig.Host) *sshconfig.Host {
+	if p.Command.Keyword == "" {
+		return host
+	}
+
+	command := p.Command
+	command.Keyword = "RemoteCommand"
+	return host.OverrideOption(command)
+}
+
+// Retryable reports whether connecting again could succeed after err. Network
+// errors are, as they are expected while a link is down or sshd restarts,
+// while failed authentication, host key problems, cancellation and invalid
+// config fail the same way again.
+func Retryable(err error) bool {
+	var authErr *AuthError
+	var mismatchErr *HostKeyMismatchError
+	var unknownErr *UnknownHostKeyError
+	var configErr *ConfigError
+	var parseErr *sshconfig.ParseError
+	return err != nil &&
+		!errors.Is(err, ErrCancelled) &&
+		!errors.As(err, &authErr) &&
+		!errors.As(err, &mismatchErr) &&
+		!errors.As(err, &unknownErr) &&
+		!errors.As(err, &configErr) &&
+		!errors.As(err, &parseErr)
+}
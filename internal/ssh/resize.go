@@ -0,0 +1,68 @@
+package ssh
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// resizeDebounce is how long to wait for the terminal size to settle before
+// telling the server, so dragging a window does not flood the connection.
+const resizeDebounce = 100 * time.Millisecond
+
+// resizePollInterval is how often the terminal size is checked on platforms
+// that do not signal size changes.
+const resizePollInterval = 500 * time.Millisecond
+
+// watchResize forwards size changes of the terminal fd, which currently has
+// the given size, to the pseudo-terminal of session. The returned function
+// stops watching and waits until it has.
+func watchResize(fd int, session *ssh.Session, width, height int) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	signals, stopSignals := resizeSignals()
+
+	// Fall back to checking the size regularly
+	var poll <-chan time.Time
+	if signals == nil {
+		ticker := time.NewTicker(resizePollInterval)
+		poll = ticker.C
+		stopSignals = ticker.Stop
+	}
+
+	go func() {
+		defer close(stopped)
+		defer stopSignals()
+
+		var settled <-chan time.Time
+		update := func() {
+			w, h, err := term.GetSize(fd)
+			if err != nil || (w == width && h == height) {
+				return
+			}
+			width, height = w, h
+			session.WindowChange(height, width)
+		}
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				settled = time.After(resizeDebounce)
+			case <-settled:
+				settled = nil
+				update()
+			case <-poll:
+				update()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package ssh
+
+import "os"
+
+// resizeSignals returns nil as there is no signal for size changes of the
+// terminal on this platform, which has to be polled instead.
+func resizeSignals() (<-chan os.Signal, func()) {
+	return nil, nil
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package ssh
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// resizeSignals returns a channel that receives a value whenever the size of
+// the terminal changes, and a function to stop the notifications.
+func resizeSignals() (<-chan os.Signal, func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+
+	return ch, func() {
+		signal.Stop(ch)
+	}
+}
@@ -0,0 +1,278 @@
+package ssh
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// socksHandshakeTimeout is how long a client has to send its SOCKS request.
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKS5 authentication methods, address types and replies, see RFC 1928
+// and RFC 1929.
+const (
+	socks5NoAuth       = 0x00
+	socks5UserPassword = 0x02
+	socks5NoMethod     = 0xff
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+
+	socks5Succeeded          = 0x00
+	socks5GeneralFailure     = 0x01
+	socks5NotAllowed         = 0x02
+	socks5ConnectionRefused  = 0x05
+	socks5CommandUnsupported = 0x07
+	socks5AddressUnsupported = 0x08
+)
+
+// SOCKS4 replies.
+const (
+	socks4Granted  = 0x5a
+	socks4Rejected = 0x5b
+)
+
+// socksConnect is the CONNECT command of SOCKS4 and SOCKS5.
+const socksConnect = 0x01
+
+// socksAuth are the credentials SOCKS5 clients have to authenticate with.
+// SOCKS4 has no authentication, so those clients are refused if they are
+// set.
+type socksAuth struct {
+	user     string
+	password string
+}
+
+// required reports whether clients have to authenticate.
+func (a *socksAuth) required() bool {
+	return a != nil && a.user != ""
+}
+
+// socksServe reads the SOCKS request of a client on conn, opens a
+// connection to the requested address with dial and sends the reply. The
+// request is either SOCKS4, SOCKS4a with a domain name, or SOCKS5, which
+// supports domain names, IPv6 and authentication with a user and password.
+func socksServe(conn net.Conn, auth *socksAuth, dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	// Connections forwarded from the server do not support deadlines
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	r := bufio.NewReader(conn)
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var other net.Conn
+	switch version {
+	case 4:
+		other, err = socks4Serve(conn, r, auth, dial)
+	case 5:
+		other, err = socks5Serve(conn, r, auth, dial)
+	default:
+		err = fmt.Errorf("socks: unsupported version %d", version)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Pass on what the client sent right after its request
+	if n := r.Buffered(); n > 0 {
+		b, _ := r.Peek(n)
+		if _, err := other.Write(b); err != nil {
+			other.Close()
+			return nil, err
+		}
+	}
+	return other, nil
+}
+
+// socks4Serve handles a SOCKS4 request after the version.
+func socks4Serve(conn net.Conn, r *bufio.Reader, auth *socksAuth, dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	var req struct {
+		Command byte
+		Port    uint16
+		IP      [4]byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &req); err != nil {
+		return nil, err
+	}
+	// The user ID is not a secret, so it is ignored
+	if _, err := r.ReadString(0); err != nil {
+		return nil, err
+	}
+
+	// SOCKS4a sends the domain name after an address of 0.0.0.x
+	host := net.IP(req.IP[:]).String()
+	if req.IP[0] == 0 && req.IP[1] == 0 && req.IP[2] == 0 && req.IP[3] != 0 {
+		domain, err := r.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		host = domain[:len(domain)-1]
+	}
+
+	reply := func(code byte) {
+		conn.Write([]byte{0, code, 0, 0, 0, 0, 0, 0})
+	}
+
+	switch {
+	case auth.required():
+		reply(socks4Rejected)
+		return nil, errors.New("socks: SOCKS4 does not support authentication")
+	case req.Command != socksConnect:
+		reply(socks4Rejected)
+		return nil, fmt.Errorf("socks: unsupported command %d", req.Command)
+	}
+
+	other, err := dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(req.Port))))
+	if err != nil {
+		reply(socks4Rejected)
+		return nil, err
+	}
+	reply(socks4Granted)
+	return other, nil
+}
+
+// socks5Serve handles the SOCKS5 method negotiation and request after the
+// version.
+func socks5Serve(conn net.Conn, r *bufio.Reader, auth *socksAuth, dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	methods, err := readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	method := byte(socks5NoAuth)
+	if auth.required() {
+		method = socks5UserPassword
+	}
+	if !slices.Contains(methods, method) {
+		conn.Write([]byte{5, socks5NoMethod})
+		return nil, errors.New("socks: no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{5, method}); err != nil {
+		return nil, err
+	}
+
+	if method == socks5UserPassword {
+		if err := socks5Authenticate(conn, r, auth); err != nil {
+			return nil, err
+		}
+	}
+
+	var req struct {
+		Version     byte
+		Command     byte
+		Reserved    byte
+		AddressType byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &req); err != nil {
+		return nil, err
+	}
+
+	reply := func(code byte) {
+		conn.Write([]byte{5, code, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	}
+
+	var host string
+	switch req.AddressType {
+	case socks5IPv4, socks5IPv6:
+		ip := make(net.IP, net.IPv4len)
+		if req.AddressType == socks5IPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return nil, err
+		}
+		host = ip.String()
+	case socks5Domain:
+		domain, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		host = string(domain)
+	default:
+		reply(socks5AddressUnsupported)
+		return nil, fmt.Errorf("socks: unsupported address type %d", req.AddressType)
+	}
+
+	var port uint16
+	if err := binary.Read(r, binary.BigEndian, &port); err != nil {
+		return nil, err
+	}
+
+	if req.Command != socksConnect {
+		reply(socks5CommandUnsupported)
+		return nil, fmt.Errorf("socks: unsupported command %d", req.Command)
+	}
+
+	other, err := dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+	if err != nil {
+		reply(socks5Reply(err))
+		return nil, err
+	}
+	reply(socks5Succeeded)
+	return other, nil
+}
+
+// socks5Authenticate checks the user and password sent by the client.
+func socks5Authenticate(conn net.Conn, r *bufio.Reader, auth *socksAuth) error {
+	if version, err := r.ReadByte(); err != nil {
+		return err
+	} else if version != 1 {
+		return fmt.Errorf("socks: unsupported authentication version %d", version)
+	}
+
+	user, err := readBytes(r)
+	if err != nil {
+		return err
+	}
+	password, err := readBytes(r)
+	if err != nil {
+		return err
+	}
+
+	if subtle.ConstantTimeCompare(user, []byte(auth.user)) != 1 ||
+		subtle.ConstantTimeCompare(password, []byte(auth.password)) != 1 {
+		conn.Write([]byte{1, 1})
+		return errors.New("socks: wrong user or password")
+	}
+	_, err = conn.Write([]byte{1, 0})
+	return err
+}
+
+// socks5Reply returns the SOCKS5 reply for a failed connection.
+func socks5Reply(err error) byte {
+	var openErr *ssh.OpenChannelError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &openErr) && openErr.Reason == ssh.Prohibited:
+		return socks5NotAllowed
+	case errors.As(err, &openErr) && openErr.Reason == ssh.ConnectionFailed,
+		errors.As(err, &opErr) && opErr.Op == "dial":
+		return socks5ConnectionRefused
+	}
+	return socks5GeneralFailure
+}
+
+// readBytes reads a length byte followed by that many bytes.
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	n, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(r, b)
+	return b, err
+}
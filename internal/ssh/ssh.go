@@ -1,97 +1,79 @@
 package ssh
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"os/signal"
-	"path"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/skryvvara/gossht/internal/sshconfig"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
-	"golang.org/x/crypto/ssh/knownhosts"
 	"golang.org/x/term"
 )
 
-func SSHAgent() ssh.AuthMethod {
-	if sshAgent, err := net.Dial("unix", os.Getenv("SSH_AUTH_SOCK")); err == nil {
-		return ssh.PublicKeysCallback(agent.NewClient(sshAgent).Signers)
-	}
-	return nil
-}
+// SSHConnect opens an interactive session on host. Jump hosts configured
+// with ProxyJump are resolved with resolver. The port forwardings of forwards
+// are set up for the duration of the session, if forwards is nil those
+// configured for host are. An error is returned if the connection could not
+// be established or was lost, see errors.go for the errors to expect.
+func SSHConnect(host *sshconfig.Host, resolver *sshconfig.Resolver, prompter Prompter, forwards *Forwards) error {
+	d := &dialer{resolver: resolver, prompter: prompter}
 
-func SSHConnect(host, user string) {
-	sshPath := path.Join(os.Getenv("HOME"), ".ssh")
-	//TODO: support other keys than id_rsa and custom paths
-	//keyPath := path.Join(sshPath, "id_rsa")
-
-	var err error
-	//var signer ssh.Signer
-
-	// Read the private key file
-	/*
-		pKey, err := os.ReadFile(keyPath)
-		if err != nil {
-			log.Fatalf("unable to read private key: %v", err)
-		}*/
-
-	/*
-		signer, err = ssh.ParsePrivateKey(pKey)
-		if err != nil {
-			fmt.Println(err.Error())
-		}*/
-
-	var hostkeyCallback ssh.HostKeyCallback
-	hostkeyCallback, err = knownhosts.New(path.Join(sshPath, "known_hosts"))
+	client, err := d.connect(host, nil, 0)
 	if err != nil {
-		fmt.Println(err.Error())
+		return err
 	}
+	defer client.Close()
 
-	conf := &ssh.ClientConfig{
-		User:            user,
-		HostKeyCallback: hostkeyCallback,
-		Auth: []ssh.AuthMethod{
-			SSHAgent(),
-		},
-		Timeout: time.Millisecond * 1000,
-	}
+	keepAlive := startKeepAlive(client, host)
+	defer keepAlive.Stop()
 
-	client, err := ssh.Dial("tcp", host, conf)
-	if err != nil {
-		// Handle specific errors
-		if isConnectionError(err) {
-			fmt.Printf("Failed to dial SSH connection: %v\n", err)
-			return
-		}
-		fmt.Printf("Unknown error while dialing SSH connection: %v\n", err)
-		return
+	if forwards == nil {
+		forwards = NewForwards(host)
+	}
+	defer forwards.Stop()
+	if err := forwards.Start(client, host.Flag("ExitOnForwardFailure")); err != nil {
+		return fmt.Errorf("port forwarding failed: %w", err)
+	}
+	for _, warning := range forwards.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
 	}
-	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
-		log.Fatal("Failed to create session: ", err)
+		return &ChannelError{Op: "open a session", Err: err}
 	}
 	defer session.Close()
 
+	// Like OpenSSH, the session is opened even if the agent cannot be
+	// forwarded
+	if ForwardsAgent(host) {
+		if err := forwardAgent(client, session, forwardAgentSocket(host)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: agent forwarding failed: %v\n", err)
+		}
+	}
+
 	// Get the terminal file descriptor
 	fd := int(os.Stdin.Fd())
 
 	// Put the terminal into raw mode
 	oldState, err := term.MakeRaw(fd)
 	if err != nil {
-		log.Fatalf("Failed to set terminal to raw mode: %v", err)
+		return fmt.Errorf("failed to set the terminal to raw mode: %w", err)
 	}
 	defer term.Restore(fd, oldState)
 
 	// Get the terminal size
 	width, height, err := term.GetSize(fd)
 	if err != nil {
-		log.Fatalf("Failed to get terminal size: %v", err)
+		return fmt.Errorf("failed to get the terminal size: %w", err)
 	}
 
 	modes := ssh.TerminalModes{
@@ -103,68 +85,154 @@ func SSHConnect(host, user string) {
 
 	// Request a pseudo-terminal
 	if err := session.RequestPty("xterm-256color", height, width, modes); err != nil {
-		log.Fatalf("Request for pseudo terminal failed: %v", err)
+		return &ChannelError{Op: "request a pseudo-terminal", Err: err}
+	}
+
+	// Set input and output, handling escape sequences in the input
+	input := openInput()
+	defer input.Close()
+	escapes := newEscapeFilter(input, os.Stderr, parseEscapeChar(host.Get("EscapeChar")))
+	escapes.host = host.WithDefaults().HostName
+	escapes.session = session
+	escapes.forwards = forwards
+
+	var disconnected atomic.Bool
+	escapes.disconnect = func() {
+		disconnected.Store(true)
+		client.Close()
+	}
+	escapes.suspend = func() error {
+		return suspendTerminal(fd, oldState)
 	}
 
-	// Set input and output
 	session.Stdout = os.Stdout
-	session.Stdin = os.Stdin
+	session.Stdin = escapes
 	session.Stderr = os.Stderr
 
-	if err := session.Shell(); err != nil {
-		log.Fatal("failed to start shell: ", err)
+	// Run the RemoteCommand if there is one, otherwise a shell
+	if command := remoteCommand(host); command != "" {
+		if err := session.Start(command); err != nil {
+			return &ChannelError{Op: "run the remote command", Err: err}
+		}
+	} else if err := session.Shell(); err != nil {
+		return &ChannelError{Op: "start the shell", Err: err}
 	}
 
-	/*
-		// Handle terminal resizing
-		go func() {
-			sigCh := make(chan os.Signal, 1)
-			signal.Notify(sigCh, syscall.SIGWINCH)
-			for range sigCh {
-				width, height, _ := term.GetSize(fd)
-				session.WindowChange(height, width)
-			}
-		}() */
+	// Handle terminal resizing
+	stopResize := watchResize(fd, session, width, height)
+	defer stopResize()
 
 	// Handle termination signals
 	signalCh := make(chan os.Signal, 1)
 	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	done := make(chan struct{})
+	defer close(done)
 
 	go func() {
-		<-signalCh // Wait for signal
-		session.Close()
+		select {
+		case <-signalCh:
+			session.Close()
+		case <-done:
+		}
 	}()
 
 	err = session.Wait()
-	if err != nil {
-		log.Fatal("Failed to run: " + err.Error())
+	if keepAlive.Lost() {
+		return fmt.Errorf("%w: %s did not answer %d keepalive requests", ErrConnectionLost, host.Alias, keepAlive.countMax)
+	}
+
+	// A non-zero exit status of the shell is not an error of the
+	// connection, and the session ends without an exit status if the
+	// connection dropped
+	var exitErr *ssh.ExitError
+	var exitMissing *ssh.ExitMissingError
+	switch {
+	case err == nil, disconnected.Load(), errors.As(err, &exitErr):
+		return nil
+	case errors.As(err, &exitMissing):
+		return fmt.Errorf("%w: the connection to %s was closed unexpectedly", ErrConnectionLost, host.Alias)
 	}
+	return fmt.Errorf("session failed: %w", err)
 }
 
-// Helper function to check if the error is due to connection issues
-func isConnectionError(err error) bool {
-	if err == nil {
-		return false
+// remoteCommand returns the expanded RemoteCommand of host, or an empty
+// string if a shell should be started.
+func remoteCommand(host *sshconfig.Host) string {
+	o, ok := host.Lookup("RemoteCommand")
+	if !ok || strings.EqualFold(o.Value(), "none") {
+		return ""
+	}
+	return host.Tokens().Expand(o.Command())
+}
+
+// clientConfig returns the configuration for connecting to host at target,
+// verifying its host key against the known hosts files.
+func clientConfig(host *sshconfig.Host, target *Target, agentClient agent.ExtendedAgent, prompter Prompter, attempts *authAttempts) (*ssh.ClientConfig, error) {
+	verifier, err := newHostKeyVerifier(host, target, prompter)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check for specific errors indicating connection issues
-	if strings.Contains(err.Error(), "connection refused") {
-		return true
+	return &ssh.ClientConfig{
+		User:              host.User,
+		HostKeyCallback:   verifier.check,
+		HostKeyAlgorithms: verifier.algorithms(),
+		Auth:              authMethods(host, agentClient, prompter, attempts),
+	}, nil
+}
+
+// dial connects to target and performs the SSH handshake.
+func dial(target *Target, conf *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := target.Dial(context.Background())
+	if err != nil {
+		return nil, err
 	}
 
-	// Check for network errors
-	if ne, ok := err.(*net.OpError); ok {
-		if se, ok := ne.Err.(*os.SyscallError); ok {
-			if se.Err == syscall.ECONNREFUSED || se.Err == syscall.EHOSTUNREACH || se.Err == syscall.ETIMEDOUT {
-				return true
-			}
+	return handshake(conn, target, conf)
+}
+
+// handshake performs the SSH handshake with target over conn. The key
+// exchange has to finish within the connect timeout, authentication may take
+// as long as the user needs to answer prompts. The connection is closed if
+// the handshake fails, failures once the host key was accepted are returned
+// as an *AuthError.
+func handshake(conn net.Conn, target *Target, conf *ssh.ClientConfig) (*ssh.Client, error) {
+	// Connections tunnelled through a jump host do not support deadlines,
+	// closing the connection aborts the handshake for those as well
+	var timedOut, verified atomic.Bool
+	timer := time.AfterFunc(target.ConnectTimeout, func() {
+		timedOut.Store(true)
+		conn.Close()
+	})
+
+	// The host key is checked once the key exchange is done
+	c := *conf
+	c.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		timer.Stop()
+		if conf.HostKeyCallback == nil {
+			return errors.New("no host key callback")
+		}
+		if err := conf.HostKeyCallback(hostname, remote, key); err != nil {
+			return err
 		}
+		verified.Store(true)
+		return nil
 	}
 
-	// Check for context deadline exceeded error
-	if strings.Contains(err.Error(), "context deadline exceeded") {
-		return true
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, target.Addr(), &c)
+	timer.Stop()
+	if err != nil {
+		conn.Close()
+		switch {
+		case timedOut.Load():
+			return nil, &TimeoutError{Addr: target.Addr(), Timeout: target.ConnectTimeout, Err: err}
+		case verified.Load() && !errors.Is(err, ErrCancelled):
+			return nil, &AuthError{User: conf.User, Host: target.HostName, Err: err}
+		}
+		return nil, err
 	}
 
-	return false
+	return ssh.NewClient(sshConn, chans, reqs), nil
 }
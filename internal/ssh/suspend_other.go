@@ -0,0 +1,15 @@
+//go:build !unix
+
+package ssh
+
+import (
+	"errors"
+
+	"golang.org/x/term"
+)
+
+// suspendTerminal fails as processes cannot be stopped like with ^Z in a
+// shell on this platform.
+func suspendTerminal(fd int, state *term.State) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package ssh
+
+import (
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+// suspendTerminal stops the process like ^Z in a shell. The terminal is
+// restored to state while stopped and put back into raw mode once the
+// process is continued.
+func suspendTerminal(fd int, state *term.State) error {
+	if err := term.Restore(fd, state); err != nil {
+		return err
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTSTP); err != nil {
+		return err
+	}
+
+	_, err := term.MakeRaw(fd)
+	return err
+}
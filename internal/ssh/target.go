@@ -0,0 +1,130 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skryvvara/gossht/internal/sshconfig"
+)
+
+// DefaultConnectTimeout is used for each connection attempt if the host has
+// no ConnectTimeout.
+const DefaultConnectTimeout = 10 * time.Second
+
+// Target is the network address of a host and the options controlling how
+// it is dialed.
+type Target struct {
+	HostName       string
+	Port           int
+	ConnectTimeout time.Duration
+	AddressFamily  string // any, inet or inet6
+	BindAddress    string
+}
+
+// NewTarget returns the target for host. The alias is used if the host has no
+// HostName and port 22 if it has no Port.
+func NewTarget(host *sshconfig.Host) *Target {
+	host = host.WithDefaults()
+
+	t := &Target{
+		HostName:       strings.TrimSuffix(strings.TrimPrefix(host.HostName, "["), "]"),
+		Port:           host.Port,
+		ConnectTimeout: host.ConnectTimeout,
+		AddressFamily:  strings.ToLower(host.AddressFamily),
+		BindAddress:    host.BindAddress,
+	}
+	if t.ConnectTimeout <= 0 {
+		t.ConnectTimeout = DefaultConnectTimeout
+	}
+
+	return t
+}
+
+// Addr returns the address of the target in host:port form, with IPv6
+// addresses enclosed in brackets.
+func (t *Target) Addr() string {
+	return net.JoinHostPort(t.HostName, strconv.Itoa(t.Port))
+}
+
+// network returns the network name restricted to the configured address
+// family.
+func (t *Target) network(base string) string {
+	switch t.AddressFamily {
+	case "inet":
+		return base + "4"
+	case "inet6":
+		return base + "6"
+	}
+	return base
+}
+
+// Dial resolves the host name of the target and tries to connect to each of
+// its addresses in turn, returning the first connection that succeeds. It
+// returns a *DNSError if the name cannot be resolved, a *TimeoutError if no
+// address answered in time and a *DialError otherwise.
+func (t *Target) Dial(ctx context.Context) (net.Conn, error) {
+	addrs, err := t.lookup(ctx, t.HostName)
+	if err != nil {
+		return nil, &DNSError{HostName: t.HostName, Err: err}
+	}
+
+	dialer := &net.Dialer{Timeout: t.ConnectTimeout}
+	if t.BindAddress != "" {
+		local, err := t.lookup(ctx, t.BindAddress)
+		if err != nil {
+			return nil, fmt.Errorf("bind address: %w", &DNSError{HostName: t.BindAddress, Err: err})
+		}
+		dialer.LocalAddr = &net.TCPAddr{IP: net.IP(local[0].AsSlice()), Zone: local[0].Zone()}
+	}
+
+	var errs []error
+	timedOut := true
+	for _, addr := range addrs {
+		conn, err := dialer.DialContext(ctx, t.network("tcp"), netip.AddrPortFrom(addr, uint16(t.Port)).String())
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			timedOut = false
+		}
+	}
+
+	if timedOut {
+		return nil, &TimeoutError{Addr: t.Addr(), Timeout: t.ConnectTimeout, Err: errors.Join(errs...)}
+	}
+	return nil, &DialError{Addr: t.Addr(), Err: errors.Join(errs...)}
+}
+
+// lookup returns the addresses of host in the configured address family.
+// IP address literals are returned as they are.
+func (t *Target) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, t.network("ip"), host)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]netip.Addr, 0, len(ips))
+	for _, ip := range ips {
+		if addr, ok := netip.AddrFromSlice(ip); ok {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+
+	return addrs, nil
+}
@@ -0,0 +1,290 @@
+// Package sshconfig reads OpenSSH client configuration files.
+//
+// Files are tokenised with the same rules as OpenSSH: keywords are case
+// insensitive, arguments may be quoted and separated from the keyword by
+// whitespace or '=', and for most keywords the first value obtained wins.
+package sshconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BlockKind describes what kind of section of a config file a block is.
+type BlockKind int
+
+const (
+	// GlobalBlock holds the options before the first Host or Match line.
+	GlobalBlock BlockKind = iota
+	// HostBlock is a section started by a Host line.
+	HostBlock
+	// MatchBlock is a section started by a Match line.
+	MatchBlock
+)
+
+// Option is a single keyword and its arguments together with the place it was
+// read from. Options that were not read from a file have an empty Path.
+type Option struct {
+	Keyword string
+	Args    []string
+	Raw     string // The arguments as written in the file
+	Path    string
+	Line    int
+}
+
+// Value returns the arguments of the option joined by a single space.
+func (o Option) Value() string {
+	return strings.Join(o.Args, " ")
+}
+
+// Command returns the arguments as written in the file, which is how OpenSSH
+// passes options like ProxyCommand to the shell. Options that were not read
+// from a file return their quoted arguments.
+func (o Option) Command() string {
+	if o.Raw == "" {
+		return JoinArgs(o.Args)
+	}
+	return o.Raw
+}
+
+// Block is a Host or Match section of a config file, or the global options
+// that precede the first such section.
+type Block struct {
+	Kind     BlockKind
+	Patterns []string // Host patterns or Match criteria
+	Path     string
+	Line     int // Line of the Host or Match keyword, 0 for the global block
+	Options  []Option
+}
+
+// Config is a parsed ssh_config file. It keeps the raw lines of the file so
+// it can be written back unchanged apart from the edits made to it.
+type Config struct {
+	Path   string
+	Blocks []*Block
+
+	lines    []rawLine
+	includes [][]*Config // Files included by each Include option, in order
+}
+
+// rawLine is a line of a config file and the terminator that ended it.
+type rawLine struct {
+	text string
+	eol  string
+}
+
+// ParseError reports a problem in a config file together with its location.
+type ParseError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s line %d: %v", e.Path, e.Line, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DefaultUserConfig returns the path of the per-user config file.
+func DefaultUserConfig() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.Getenv("HOME")
+	}
+	return filepath.Join(home, ".ssh", "config")
+}
+
+// ParseFile reads and parses the config file at path.
+func ParseFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f, path)
+}
+
+// Parse parses a config file read from r. The path is only used to describe
+// where options and errors come from.
+func Parse(r io.Reader, path string) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Path: path}
+	for len(data) > 0 {
+		var line rawLine
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line.text, line.eol, data = string(data[:i]), "\n", data[i+1:]
+			if strings.HasSuffix(line.text, "\r") {
+				line.text, line.eol = line.text[:len(line.text)-1], "\r\n"
+			}
+		} else {
+			line.text, data = string(data), nil
+		}
+		cfg.lines = append(cfg.lines, line)
+	}
+
+	if err := cfg.build(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// build splits the raw lines of the file into blocks and options.
+func (c *Config) build() error {
+	block := &Block{Kind: GlobalBlock, Path: c.Path}
+	blocks := []*Block{block}
+
+	for i, line := range c.lines {
+		lineNumber := i + 1
+
+		parts, err := scanLine(line.text)
+		if err != nil {
+			return &ParseError{Path: c.Path, Line: lineNumber, Err: err}
+		}
+		keyword, args := parts.keyword, parts.args
+		if keyword == "" {
+			continue // Skip empty lines and comments
+		}
+
+		keyword, _ = CanonicalKeyword(keyword)
+		if len(args) == 0 {
+			return &ParseError{Path: c.Path, Line: lineNumber, Err: fmt.Errorf("%s: %w", keyword, errMissingArgument)}
+		}
+		if err := validate(keyword, args); err != nil {
+			return &ParseError{Path: c.Path, Line: lineNumber, Err: fmt.Errorf("%s: %w", keyword, err)}
+		}
+
+		switch keyword {
+		case "Host", "Match":
+			kind := HostBlock
+			if keyword == "Match" {
+				kind = MatchBlock
+			}
+			block = &Block{Kind: kind, Patterns: args, Path: c.Path, Line: lineNumber}
+			blocks = append(blocks, block)
+		default:
+			block.Options = append(block.Options, Option{
+				Keyword: keyword,
+				Args:    args,
+				Raw:     line.text[parts.argsStart:parts.argsEnd],
+				Path:    c.Path,
+				Line:    lineNumber,
+			})
+		}
+	}
+
+	c.Blocks = blocks
+	return nil
+}
+
+var numericKeywords = map[string]bool{
+	"CanonicalizeMaxDots":     true,
+	"ConnectionAttempts":      true,
+	"NumberOfPasswordPrompts": true,
+	"ServerAliveCountMax":     true,
+}
+
+// timeKeywords take time values like "30s" or "1m", see ParseTime.
+var timeKeywords = map[string]bool{
+	"ConnectTimeout":      true,
+	"ServerAliveInterval": true,
+}
+
+// validate checks the arguments of keywords whose values gossht interprets.
+func validate(keyword string, args []string) error {
+	switch {
+	case keyword == "Match":
+		if _, err := parseCriteria(args); err != nil {
+			return err
+		}
+	case keyword == "Port":
+		if _, err := parsePort(args[0]); err != nil {
+			return err
+		}
+	case numericKeywords[keyword]:
+		if n, err := strconv.Atoi(args[0]); err != nil || n < 0 {
+			return fmt.Errorf("bad number %q", args[0])
+		}
+	case timeKeywords[keyword]:
+		if _, err := ParseTime(args[0]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parsePort parses a port number in the range 1-65535.
+func parsePort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, errors.New("bad port " + strconv.Quote(s))
+	}
+	return port, nil
+}
+
+// Hosts returns a Host for every Host block in the file and the files it
+// includes, in the order they are read. Each Host only carries the options
+// written in its own block.
+func (c *Config) Hosts() []*Host {
+	var hosts []*Host
+	for _, b := range c.Blocks {
+		if b.Kind == HostBlock {
+			hosts = append(hosts, newHost(blockAlias(b), b, b.Options))
+		}
+
+		for _, o := range b.Options {
+			if o.Keyword != "Include" {
+				continue
+			}
+			for _, inc := range c.Included(o) {
+				hosts = append(hosts, inc.Hosts()...)
+			}
+		}
+	}
+	return hosts
+}
+
+// firstValues drops every occurrence of a single valued keyword after the
+// first one, and repeated values of multi valued keywords.
+func firstValues(options []Option) []Option {
+	seen := make(map[string]bool)
+	var result []Option
+	for _, o := range options {
+		key := o.Keyword
+		if multiValue[o.Keyword] {
+			key += "\x00" + o.Value()
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, o)
+	}
+	return result
+}
+
+// blockAlias returns the name used to refer to a Host block: its first
+// pattern that is not negated.
+func blockAlias(b *Block) string {
+	for _, p := range b.Patterns {
+		if !strings.HasPrefix(p, "!") {
+			return p
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package sshconfig
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, text string) *Config {
+	t.Helper()
+	c, err := Parse(strings.NewReader(text), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestParseBlocks(t *testing.T) {
+	c := mustParse(t, "# global\r\nUser me\r\n\r\nHost web *.example.com\r\n  HostName=web.example.com\r\nMatch host db\r\n\tPort 2222\r\n")
+
+	want := []struct {
+		kind     BlockKind
+		patterns []string
+		line     int
+		options  []string
+	}{
+		{GlobalBlock, nil, 0, []string{"User"}},
+		{HostBlock, []string{"web", "*.example.com"}, 4, []string{"HostName"}},
+		{MatchBlock, []string{"host", "db"}, 6, []string{"Port"}},
+	}
+	if len(c.Blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(c.Blocks), len(want))
+	}
+	for i, w := range want {
+		b := c.Blocks[i]
+		var keywords []string
+		for _, o := range b.Options {
+			keywords = append(keywords, o.Keyword)
+		}
+		if b.Kind != w.kind || !slices.Equal(b.Patterns, w.patterns) || b.Line != w.line || !slices.Equal(keywords, w.options) {
+			t.Errorf("block %d = %v %q line %d %q", i, b.Kind, b.Patterns, b.Line, keywords)
+		}
+	}
+
+	o := c.Blocks[1].Options[0]
+	if o.Value() != "web.example.com" || o.Line != 5 || o.Path != "config" {
+		t.Errorf("got option %+v", o)
+	}
+}
+
+func TestParseKeywordCase(t *testing.T) {
+	c := mustParse(t, "HOST web\n  hostname example.com\n  proxycommand nc  %h   %p\n")
+
+	o := c.Blocks[1].Options
+	if c.Blocks[1].Kind != HostBlock || o[0].Keyword != "HostName" || o[1].Keyword != "ProxyCommand" {
+		t.Errorf("keywords were not canonicalized: %+v", o)
+	}
+	if o[1].Command() != "nc  %h   %p" {
+		t.Errorf("Command() = %q", o[1].Command())
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		line int
+	}{
+		{"Host\n", 1},
+		{"Host web\n  HostName \"web\n", 2},
+		{"Host web\n  Port 0\n", 2},
+		{"Host web\n  Port 65536\n", 2},
+		{"Host web\n  Port ssh\n", 2},
+		{"ConnectTimeout -1\n", 1},
+		{"ConnectTimeout 2147483648\n", 1},
+		{"ServerAliveInterval 5x\n", 1},
+		{"ServerAliveCountMax -1\n", 1},
+		{"\nMatch host\n", 2},
+		{"Match all host web\n", 1},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(tt.text), "config")
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Line != tt.line || pe.Path != "config" {
+			t.Errorf("Parse(%q) error = %v, want line %d", tt.text, err, tt.line)
+		}
+	}
+}
+
+func TestParseValid(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"\n\n",
+		"# only a comment",
+		"ConnectTimeout none\n",
+		"ServerAliveInterval 1m30s\n",
+		"Match all\n",
+		"Match canonical all\n",
+		"Match sessiontype shell host web\n",
+		"UnknownKeyword value\n",
+	} {
+		if _, err := Parse(strings.NewReader(text), "config"); err != nil {
+			t.Errorf("Parse(%q) error = %v", text, err)
+		}
+	}
+}
+
+func TestHosts(t *testing.T) {
+	c := mustParse(t, "User me\nHost !bad web web2\n  HostName web.example.com\n  ConnectTimeout 1m\nHost *\n  User all\n")
+
+	hosts := c.Hosts()
+	if len(hosts) != 2 {
+		t.Fatalf("got %d hosts", len(hosts))
+	}
+	web := hosts[0]
+	if web.Alias != "web" || web.HostName != "web.example.com" || web.User != "" || web.ConnectTimeout.Seconds() != 60 {
+		t.Errorf("got host %+v", web)
+	}
+	if !slices.Equal(web.Patterns(), []string{"!bad", "web", "web2"}) {
+		t.Errorf("Patterns() = %q", web.Patterns())
+	}
+	if hosts[1].Alias != "*" || hosts[1].User != "all" {
+		t.Errorf("got host %+v", hosts[1])
+	}
+}
+
+func TestFirstValues(t *testing.T) {
+	options := []Option{
+		{Keyword: "User", Args: []string{"a"}},
+		{Keyword: "IdentityFile", Args: []string{"one"}},
+		{Keyword: "User", Args: []string{"b"}},
+		{Keyword: "IdentityFile", Args: []string{"two"}},
+		{Keyword: "IdentityFile", Args: []string{"one"}},
+		{Keyword: "Port", Args: []string{"22"}},
+	}
+
+	var got []string
+	for _, o := range firstValues(options) {
+		got = append(got, o.Keyword+" "+o.Value())
+	}
+	want := []string{"User a", "IdentityFile one", "IdentityFile two", "Port 22"}
+	if !slices.Equal(got, want) {
+		t.Errorf("firstValues = %q, want %q", got, want)
+	}
+}
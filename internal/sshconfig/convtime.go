@@ -0,0 +1,68 @@
+package sshconfig
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// timeUnits are the units of time values, see TIME FORMATS in sshd_config(5).
+var timeUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// maxTime is the largest time value, INT_MAX seconds like in OpenSSH.
+const maxTime = math.MaxInt32 * time.Second
+
+// ParseTime parses a time value like OpenSSH does for ConnectTimeout and
+// ServerAliveInterval: a sequence of numbers, each followed by an optional
+// unit, e.g. "90", "1m30s" or "1h". Numbers without a unit are seconds. The
+// value "none" is returned as 0. Negative values and values above INT_MAX
+// seconds are rejected.
+func ParseTime(s string) (time.Duration, error) {
+	if strings.EqualFold(s, "none") {
+		return 0, nil
+	}
+	if s == "" {
+		return 0, fmt.Errorf("bad time value %q", s)
+	}
+
+	var total time.Duration
+	for rest := s; rest != ""; {
+		i := 0
+		var n time.Duration
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			n = n*10 + time.Duration(rest[i]-'0')
+			if n > math.MaxInt32 {
+				return 0, fmt.Errorf("time value %q is too large", s)
+			}
+			i++
+		}
+		if i == 0 {
+			return 0, fmt.Errorf("bad time value %q", s)
+		}
+
+		unit := time.Second
+		if i < len(rest) {
+			u, ok := timeUnits[rest[i]|0x20] // Units are case insensitive
+			if !ok {
+				return 0, fmt.Errorf("bad time value %q", s)
+			}
+			unit = u
+			i++
+		}
+
+		if n > maxTime/unit || total > maxTime-n*unit {
+			return 0, fmt.Errorf("time value %q is too large", s)
+		}
+		total += n * unit
+		rest = rest[i:]
+	}
+
+	return total, nil
+}
@@ -0,0 +1,44 @@
+package sshconfig
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"10", 10 * time.Second, true},
+		{"0", 0, true},
+		{"none", 0, true},
+		{"NONE", 0, true},
+		{"10s", 10 * time.Second, true},
+		{"1m", time.Minute, true},
+		{"1m30s", 90 * time.Second, true},
+		{"1H", time.Hour, true},
+		{"2d", 48 * time.Hour, true},
+		{"1w", 7 * 24 * time.Hour, true},
+		{"1h30", time.Hour + 30*time.Second, true},
+		{"2147483647", math.MaxInt32 * time.Second, true},
+		{"2147483648", 0, false},
+		{"2147483647w", 0, false},
+		{"35791395m", 0, false},
+		{"2147483647s1s", 0, false},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"5x", 0, false},
+		{"m", 0, false},
+		{"1 m", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTime(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseTime(%q) = %v, %v, want %v, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package sshconfig
+
+import (
+	"strings"
+	"time"
+)
+
+// Host is the typed view of the options that apply to a single host.
+type Host struct {
+	// Alias is the name the host is referred to by, e.g. on the command line.
+	Alias string
+	// Block is the Host block the options were read from. It is nil for hosts
+	// returned by Lookup, whose options may come from several blocks.
+	Block *Block
+
+	HostName       string
+	User           string
+	Port           int // 0 if not set
+	IdentityFiles  []string
+	IdentitiesOnly bool
+	IdentityAgent  string
+	ConnectTimeout time.Duration // 0 if not set or none
+	AddressFamily  string
+	BindAddress    string
+
+	// Options holds every option that applies to the host in the order it
+	// was read.
+	Options []Option
+	// SkippedExec is set if Match exec blocks were left out because the
+	// Resolver was told to skip them.
+	SkippedExec bool
+}
+
+func newHost(alias string, block *Block, options []Option) *Host {
+	h := &Host{
+		Alias:   alias,
+		Block:   block,
+		Options: options,
+	}
+
+	h.HostName = h.Get("HostName")
+	h.User = h.Get("User")
+	if port, err := parsePort(h.Get("Port")); err == nil {
+		h.Port = port
+	}
+	h.IdentityFiles = h.GetAll("IdentityFile")
+	h.IdentitiesOnly = h.Flag("IdentitiesOnly")
+	h.IdentityAgent = h.Get("IdentityAgent")
+	h.ConnectTimeout, _ = ParseTime(h.Get("ConnectTimeout"))
+	h.AddressFamily = h.Get("AddressFamily")
+	h.BindAddress = h.Get("BindAddress")
+
+	return h
+}
+
+// Patterns returns the patterns of the Host block the host was read from.
+func (h *Host) Patterns() []string {
+	if h.Block == nil {
+		return []string{h.Alias}
+	}
+	return h.Block.Patterns
+}
+
+// Name returns the patterns of the host as they would be written on a Host
+// line.
+func (h *Host) Name() string {
+	return JoinArgs(h.Patterns())
+}
+
+// Lookup returns the first option set for keyword.
+func (h *Host) Lookup(keyword string) (Option, bool) {
+	keyword, _ = CanonicalKeyword(keyword)
+	for _, o := range h.Options {
+		if o.Keyword == keyword {
+			return o, true
+		}
+	}
+	return Option{}, false
+}
+
+// Get returns the value of the first option set for keyword or an empty
+// string if the keyword is not set.
+func (h *Host) Get(keyword string) string {
+	o, _ := h.Lookup(keyword)
+	return o.Value()
+}
+
+// Flag reports whether the first option set for keyword is "yes" or "true".
+func (h *Host) Flag(keyword string) bool {
+	v := strings.ToLower(h.Get(keyword))
+	return v == "yes" || v == "true"
+}
+
+// Tokens returns the percent tokens for a connection to the host.
+func (h *Host) Tokens() Tokens {
+	h = h.WithDefaults()
+	return NewTokens(h.Alias, h.HostName, h.Port, h.User)
+}
+
+// GetAll returns the value of every option set for keyword.
+func (h *Host) GetAll(keyword string) []string {
+	keyword, _ = CanonicalKeyword(keyword)
+	var values []string
+	for _, o := range h.Options {
+		if o.Keyword == keyword {
+			values = append(values, o.Value())
+		}
+	}
+	return values
+}
+
+// Override returns a copy of h where keyword is set to args, taking
+// precedence over the config files like an option given on the command line.
+func (h *Host) Override(keyword string, args ...string) *Host {
+	return h.OverrideOption(Option{Keyword: keyword, Args: args})
+}
+
+// OverrideOption is like Override but sets the option o, which keeps its raw
+// arguments and where it came from.
+func (h *Host) OverrideOption(o Option) *Host {
+	o.Keyword, _ = CanonicalKeyword(o.Keyword)
+
+	options := []Option{o}
+	for _, existing := range h.Options {
+		if existing.Keyword != o.Keyword || IsMultiValue(o.Keyword) {
+			options = append(options, existing)
+		}
+	}
+
+	return newHost(h.Alias, h.Block, options)
+}
+
+// WithDefaults returns a copy of h where HostName, Port and User are set to
+// the values OpenSSH uses when they are not configured: the alias, port 22 and
+// the local user. Default options have an empty Path.
+func (h *Host) WithDefaults() *Host {
+	localUser, _, _ := currentUser()
+	defaults := []Option{
+		{Keyword: "HostName", Args: []string{h.Alias}},
+		{Keyword: "Port", Args: []string{"22"}},
+		{Keyword: "User", Args: []string{localUser}},
+	}
+
+	options := append([]Option(nil), h.Options...)
+	for _, d := range defaults {
+		if _, ok := h.Lookup(d.Keyword); !ok && d.Value() != "" {
+			options = append(options, d)
+		}
+	}
+
+	return newHost(h.Alias, h.Block, options)
+}
@@ -0,0 +1,193 @@
+package sshconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxIncludeDepth is the maximum nesting of Include directives, the same limit
+// OpenSSH uses.
+const MaxIncludeDepth = 16
+
+// SystemConfigDir is the directory of the system wide config file. Relative
+// Include paths in the system config are resolved against it.
+const SystemConfigDir = "/etc/ssh"
+
+var (
+	errIncludeDepth = errors.New("too many nested Include directives")
+	errIncludeCycle = errors.New("config file includes itself")
+)
+
+// loader resolves Include directives while reading config files.
+type loader struct {
+	baseDir string
+	stack   []string
+}
+
+// Load reads the user config file at path and, recursively, every file it
+// includes. Relative Include paths are resolved against ~/.ssh, like OpenSSH
+// does for user config files.
+func Load(path string) (*Config, error) {
+	l := &loader{baseDir: filepath.Dir(DefaultUserConfig())}
+	return l.load(path)
+}
+
+// LoadSystem reads the system config file at path and every file it includes.
+// Relative Include paths are resolved against SystemConfigDir.
+func LoadSystem(path string) (*Config, error) {
+	l := &loader{baseDir: SystemConfigDir}
+	return l.load(path)
+}
+
+func (l *loader) load(path string) (*Config, error) {
+	cfg, err := ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.resolveIncludes(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// resolveIncludes loads every file included by cfg.
+func (l *loader) resolveIncludes(cfg *Config) error {
+	key := cfg.Path
+	if resolved, err := filepath.EvalSymlinks(key); err == nil {
+		key = resolved
+	}
+	for _, p := range l.stack {
+		if p == key {
+			return errIncludeCycle
+		}
+	}
+
+	l.stack = append(l.stack, key)
+	defer func() { l.stack = l.stack[:len(l.stack)-1] }()
+
+	cfg.includes = nil
+	for _, o := range cfg.includeOptions() {
+		included, err := l.include(o)
+		if err != nil {
+			var pe *ParseError
+			if errors.As(err, &pe) {
+				return err
+			}
+			return &ParseError{Path: o.Path, Line: o.Line, Err: err}
+		}
+		cfg.includes = append(cfg.includes, included)
+	}
+
+	return nil
+}
+
+// include loads the files matched by the arguments of an Include option. Like
+// OpenSSH, patterns that match no file and files that cannot be read are
+// silently ignored.
+func (l *loader) include(o Option) ([]*Config, error) {
+	if len(l.stack) >= MaxIncludeDepth {
+		return nil, errIncludeDepth
+	}
+
+	var configs []*Config
+	for _, arg := range o.Args {
+		pattern := ExpandPath(arg)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(l.baseDir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if fi, err := os.Stat(match); err != nil || fi.IsDir() {
+				continue
+			}
+
+			cfg, err := ParseFile(match)
+			var pe *ParseError
+			if err != nil && !errors.As(err, &pe) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if err := l.resolveIncludes(cfg); err != nil {
+				return nil, err
+			}
+			configs = append(configs, cfg)
+		}
+	}
+
+	return configs, nil
+}
+
+// ExpandPath replaces a leading ~ with the home directory and expands
+// environment variable references.
+func ExpandPath(path string) string {
+	path = os.Expand(path, func(name string) string {
+		return os.Getenv(name)
+	})
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[1:])
+		}
+	}
+
+	return path
+}
+
+// includeOptions returns the Include options of c in file order.
+func (c *Config) includeOptions() []Option {
+	var options []Option
+	for _, b := range c.Blocks {
+		for _, o := range b.Options {
+			if o.Keyword == "Include" {
+				options = append(options, o)
+			}
+		}
+	}
+	return options
+}
+
+// Included returns the files included by the Include option o of c.
+func (c *Config) Included(o Option) []*Config {
+	// Included files are stored in the order of the Include options, which
+	// stays valid when edits move lines around
+	for i, opt := range c.includeOptions() {
+		if opt.Line == o.Line && i < len(c.includes) {
+			return c.includes[i]
+		}
+	}
+	return nil
+}
+
+// Files returns c and every file it includes, directly or indirectly, in the
+// order they are read.
+func (c *Config) Files() []*Config {
+	files := []*Config{c}
+	for _, included := range c.includes {
+		for _, inc := range included {
+			files = append(files, inc.Files()...)
+		}
+	}
+	return files
+}
+
+// File returns the file with the given path out of c and the files it
+// includes, or nil if there is none.
+func (c *Config) File(path string) *Config {
+	for _, f := range c.Files() {
+		if f.Path == path {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sshconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes files named relative to dir and returns dir.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(strings.ReplaceAll(text, "$DIR", dir)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func hostAliases(c *Config) string {
+	var aliases []string
+	for _, h := range c.Hosts() {
+		aliases = append(aliases, h.Alias)
+	}
+	return strings.Join(aliases, " ")
+}
+
+func TestLoadInclude(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "in place",
+			files: map[string]string{
+				"config": "Host a\nInclude $DIR/b\nHost c\n",
+				"b":      "Host b\n",
+			},
+			want: "a b c",
+		},
+		{
+			name: "glob in name order",
+			files: map[string]string{
+				"config":     "Include $DIR/conf.d/*\n",
+				"conf.d/2-y": "Host y\n",
+				"conf.d/1-x": "Host x\n",
+			},
+			want: "x y",
+		},
+		{
+			name: "several arguments",
+			files: map[string]string{
+				"config": "Include $DIR/b $DIR/c\n",
+				"b":      "Host b\n",
+				"c":      "Host c\n",
+			},
+			want: "b c",
+		},
+		{
+			name: "nested",
+			files: map[string]string{
+				"config": "Include $DIR/b\n",
+				"b":      "Host b\nInclude $DIR/c\n",
+				"c":      "Host c\n",
+			},
+			want: "b c",
+		},
+		{
+			name: "missing files and directories are skipped",
+			files: map[string]string{
+				"config":    "Include $DIR/missing $DIR/dir $DIR/nomatch*\nHost a\n",
+				"dir/inner": "Host inner\n",
+			},
+			want: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			c, err := Load(filepath.Join(dir, "config"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hostAliases(c); got != tt.want {
+				t.Errorf("got hosts %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIncludeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  error
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"config": "Include $DIR/b\n",
+				"b":      "Include $DIR/config\n",
+			},
+			want: errIncludeCycle,
+		},
+		{
+			name:  "includes itself",
+			files: map[string]string{"config": "Include $DIR/config\n"},
+			want:  errIncludeCycle,
+		},
+		{
+			name: "parse error in included file",
+			files: map[string]string{
+				"config": "Include $DIR/b\n",
+				"b":      "Port nope\n",
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			_, err := Load(filepath.Join(dir, "config"))
+			var pe *ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("got error %v, want a ParseError", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadIncludeDepth(t *testing.T) {
+	// A chain of files each including the next one
+	chain := func(n int) map[string]string {
+		files := map[string]string{}
+		for i := 0; i < n; i++ {
+			files[fmt.Sprint(i)] = fmt.Sprintf("Host h%d\nInclude $DIR/%d\n", i, i+1)
+		}
+		files[fmt.Sprint(n)] = fmt.Sprintf("Host h%d\n", n)
+		return files
+	}
+
+	dir := writeFiles(t, chain(MaxIncludeDepth-1))
+	c, err := Load(filepath.Join(dir, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.Hosts()); got != MaxIncludeDepth {
+		t.Errorf("got %d hosts, want %d", got, MaxIncludeDepth)
+	}
+
+	dir = writeFiles(t, chain(MaxIncludeDepth))
+	if _, err := Load(filepath.Join(dir, "0")); !errors.Is(err, errIncludeDepth) {
+		t.Errorf("got error %v, want %v", err, errIncludeDepth)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config": "Include $DIR/b\nInclude $DIR/c\n",
+		"b":      "Include $DIR/d\n",
+		"c":      "",
+		"d":      "",
+	})
+	c, err := Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range c.Files() {
+		names = append(names, filepath.Base(f.Path))
+	}
+	if got := strings.Join(names, " "); got != "config b d c" {
+		t.Errorf("Files() = %s", got)
+	}
+	if f := c.File(filepath.Join(dir, "d")); f == nil || f.Path != filepath.Join(dir, "d") {
+		t.Errorf("File() = %v", f)
+	}
+	if f := c.File(filepath.Join(dir, "missing")); f != nil {
+		t.Errorf("File() of a missing file = %v", f)
+	}
+}
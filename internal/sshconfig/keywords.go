@@ -0,0 +1,94 @@
+package sshconfig
+
+import "strings"
+
+// keywords lists every client keyword known to OpenSSH in its canonical
+// spelling. Keywords are matched case-insensitively.
+var keywords = []string{
+	"AddKeysToAgent", "AddressFamily", "BatchMode", "BindAddress",
+	"BindInterface", "CanonicalDomains", "CanonicalizeFallbackLocal",
+	"CanonicalizeHostname", "CanonicalizeMaxDots",
+	"CanonicalizePermittedCNAMEs", "CASignatureAlgorithms", "CertificateFile",
+	"ChannelTimeout", "CheckHostIP", "Ciphers", "ClearAllForwardings",
+	"Compression", "ConnectionAttempts", "ConnectTimeout", "ControlMaster",
+	"ControlPath", "ControlPersist", "DynamicForward",
+	"EnableEscapeCommandline", "EnableSSHKeysign", "EscapeChar",
+	"ExitOnForwardFailure", "FingerprintHash", "ForkAfterAuthentication",
+	"ForwardAgent", "ForwardX11", "ForwardX11Timeout", "ForwardX11Trusted",
+	"GatewayPorts", "GlobalKnownHostsFile", "GSSAPIAuthentication",
+	"GSSAPIDelegateCredentials", "HashKnownHosts", "Host",
+	"HostbasedAcceptedAlgorithms", "HostbasedAuthentication",
+	"HostKeyAlgorithms", "HostKeyAlias", "HostName", "IdentitiesOnly",
+	"IdentityAgent", "IdentityFile", "IgnoreUnknown", "Include", "IPQoS",
+	"KbdInteractiveAuthentication", "KbdInteractiveDevices", "KexAlgorithms",
+	"KnownHostsCommand", "LocalCommand", "LocalForward", "LogLevel",
+	"LogVerbose", "MACs", "Match", "NoHostAuthenticationForLocalhost",
+	"NumberOfPasswordPrompts", "ObscureKeystrokeTiming",
+	"PasswordAuthentication", "PermitLocalCommand", "PermitRemoteOpen",
+	"PKCS11Provider", "Port", "PreferredAuthentications", "ProxyCommand",
+	"ProxyJump", "ProxyUseFdpass", "PubkeyAcceptedAlgorithms",
+	"PubkeyAuthentication", "RekeyLimit", "RemoteCommand", "RemoteForward",
+	"RequestTTY", "RequiredRSASize", "RevokedHostKeys", "SecurityKeyProvider",
+	"SendEnv", "ServerAliveCountMax", "ServerAliveInterval", "SessionType",
+	"SetEnv", "StdinNull", "StreamLocalBindMask", "StreamLocalBindUnlink",
+	"StrictHostKeyChecking", "SyslogFacility", "Tag", "TCPKeepAlive", "Tunnel",
+	"TunnelDevice", "UpdateHostKeys", "User", "UserKnownHostsFile",
+	"VerifyHostKeyDNS", "VisualHostKey", "XAuthLocation",
+}
+
+// gosshtKeywords are the keywords only gossht understands. OpenSSH rejects
+// them unless they are listed with IgnoreUnknown.
+var gosshtKeywords = []string{
+	"GosshtReconnect", "GosshtReconnectCommand", "GosshtSocksUser",
+	"GosshtSocksPassword",
+}
+
+// aliases maps deprecated keyword names to their current spelling.
+var aliases = map[string]string{
+	"challengeresponseauthentication": "KbdInteractiveAuthentication",
+	"hostbasedkeytypes":               "HostbasedAcceptedAlgorithms",
+	"pubkeyacceptedkeytypes":          "PubkeyAcceptedAlgorithms",
+	"keepalive":                       "TCPKeepAlive",
+}
+
+// multiValue lists the keywords that accumulate values instead of using the
+// first value obtained.
+var multiValue = map[string]bool{
+	"CertificateFile": true,
+	"DynamicForward":  true,
+	"IdentityFile":    true,
+	"LocalForward":    true,
+	"RemoteForward":   true,
+	"SendEnv":         true,
+}
+
+var canonical = func() map[string]string {
+	m := make(map[string]string, len(keywords)+len(gosshtKeywords)+len(aliases))
+	for _, k := range keywords {
+		m[strings.ToLower(k)] = k
+	}
+	for _, k := range gosshtKeywords {
+		m[strings.ToLower(k)] = k
+	}
+	for k, v := range aliases {
+		m[k] = v
+	}
+	return m
+}()
+
+// CanonicalKeyword returns the canonical spelling of keyword and whether it is
+// a keyword known to OpenSSH or gossht. Unknown keywords are returned
+// unchanged.
+func CanonicalKeyword(keyword string) (string, bool) {
+	if k, ok := canonical[strings.ToLower(keyword)]; ok {
+		return k, true
+	}
+	return keyword, false
+}
+
+// IsMultiValue reports whether every occurrence of keyword is used rather than
+// only the first one.
+func IsMultiValue(keyword string) bool {
+	k, _ := CanonicalKeyword(keyword)
+	return multiValue[k]
+}
@@ -0,0 +1,162 @@
+package sshconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// matchPattern reports whether s matches the OpenSSH wildcard pattern, where
+// '*' matches any sequence of characters and '?' matches exactly one.
+func matchPattern(s, pattern string) bool {
+	for {
+		if pattern == "" {
+			return s == ""
+		}
+
+		switch pattern[0] {
+		case '*':
+			// Collapse consecutive stars and try every possible suffix
+			for pattern != "" && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if pattern == "" {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(s[i:], pattern) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if s == "" {
+				return false
+			}
+		default:
+			if s == "" || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		s = s[1:]
+		pattern = pattern[1:]
+	}
+}
+
+// matchPatternList matches s against a list of patterns, each of which may be
+// negated with a leading '!'. It returns true if at least one pattern matches
+// and no negated pattern does.
+func matchPatternList(s string, patterns []string, fold bool) bool {
+	if fold {
+		s = strings.ToLower(s)
+	}
+
+	matched := false
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		if negated {
+			p = p[1:]
+		}
+		if fold {
+			p = strings.ToLower(p)
+		}
+
+		if matchPattern(s, p) {
+			if negated {
+				return false
+			}
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// criterion is a single condition of a Match line.
+type criterion struct {
+	name        string
+	arg         string
+	negated     bool
+	unsupported bool // Never matches
+}
+
+// criteriaWithArgument lists the Match criteria that take an argument.
+var criteriaWithArgument = map[string]bool{
+	"exec":         true,
+	"host":         true,
+	"localnetwork": true,
+	"localuser":    true,
+	"originalhost": true,
+	"tagged":       true,
+	"user":         true,
+}
+
+// knownCriterion reports whether arg is the name of a supported criterion.
+func knownCriterion(arg string) bool {
+	name := strings.TrimPrefix(strings.ToLower(arg), "!")
+	return name == "all" || name == "canonical" || name == "final" || criteriaWithArgument[name]
+}
+
+// parseCriteria parses the arguments of a Match line.
+func parseCriteria(args []string) ([]criterion, error) {
+	var criteria []criterion
+	hasAll := false
+
+	for i := 0; i < len(args); i++ {
+		c := criterion{name: strings.ToLower(args[i])}
+		if strings.HasPrefix(c.name, "!") {
+			c.negated = true
+			c.name = c.name[1:]
+		}
+
+		switch {
+		case c.name == "all":
+			hasAll = true
+		case c.name == "canonical" || c.name == "final":
+		case criteriaWithArgument[c.name]:
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, fmt.Errorf("missing argument for %s", c.name)
+			}
+			i++
+			c.arg = args[i]
+		default:
+			// Criteria of newer OpenSSH versions, like sessiontype, never
+			// match. Most take an argument, which is skipped along.
+			c.unsupported = true
+			if i+1 < len(args) && !knownCriterion(args[i+1]) {
+				i++
+				c.arg = args[i]
+			}
+		}
+
+		criteria = append(criteria, c)
+	}
+
+	// "all" may only be combined with "canonical" and "final"
+	if hasAll {
+		for _, c := range criteria {
+			if c.name != "all" && c.name != "canonical" && c.name != "final" && !c.unsupported {
+				return nil, errors.New("all must appear alone or with canonical/final")
+			}
+		}
+	}
+
+	return criteria, nil
+}
+
+// matchCIDRList reports whether addr is inside one of the comma separated
+// networks in list.
+func matchCIDRList(addr net.IP, list string) (bool, error) {
+	for _, cidr := range strings.Split(list, ",") {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return false, fmt.Errorf("invalid network %q", cidr)
+		}
+		if network.Contains(addr) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,117 @@
+package sshconfig
+
+import (
+	"net"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"web", "web", true},
+		{"web", "we", false},
+		{"web", "*", true},
+		{"", "*", true},
+		{"web.example.com", "*.example.com", true},
+		{"example.com", "*.example.com", false},
+		{"web1", "web?", true},
+		{"web", "web?", false},
+		{"web12", "web?", false},
+		{"a.b.c", "a**c", true},
+		{"abc", "*b*", true},
+		{"abc", "*d*", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchPattern(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("matchPattern(%q, %q) = %v", tt.s, tt.pattern, got)
+		}
+	}
+}
+
+func TestMatchPatternList(t *testing.T) {
+	tests := []struct {
+		s        string
+		patterns []string
+		fold     bool
+		want     bool
+	}{
+		{"web", []string{"db", "web"}, false, true},
+		{"web", []string{"db"}, false, false},
+		{"web", []string{"*", "!web"}, false, false},
+		{"web", []string{"!web", "*"}, false, false},
+		{"db", []string{"*", "!web"}, false, true},
+		{"db", []string{"!web"}, false, false},
+		{"WEB", []string{"web"}, false, false},
+		{"WEB", []string{"web"}, true, true},
+		{"web", []string{"WE*"}, true, true},
+	}
+
+	for _, tt := range tests {
+		if got := matchPatternList(tt.s, tt.patterns, tt.fold); got != tt.want {
+			t.Errorf("matchPatternList(%q, %q, %v) = %v", tt.s, tt.patterns, tt.fold, got)
+		}
+	}
+}
+
+func TestParseCriteria(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []criterion
+		ok   bool
+	}{
+		{[]string{"all"}, []criterion{{name: "all"}}, true},
+		{[]string{"canonical", "all"}, []criterion{{name: "canonical"}, {name: "all"}}, true},
+		{[]string{"Host", "web,db", "!User", "root"}, []criterion{{name: "host", arg: "web,db"}, {name: "user", arg: "root", negated: true}}, true},
+		{[]string{"exec", "test -f x"}, []criterion{{name: "exec", arg: "test -f x"}}, true},
+		{[]string{"final"}, []criterion{{name: "final"}}, true},
+		{[]string{"sessiontype", "shell", "host", "web"}, []criterion{{name: "sessiontype", arg: "shell", unsupported: true}, {name: "host", arg: "web"}}, true},
+		{[]string{"newcriterion", "host", "web"}, []criterion{{name: "newcriterion", unsupported: true}, {name: "host", arg: "web"}}, true},
+		{[]string{"all", "sessiontype", "shell"}, []criterion{{name: "all"}, {name: "sessiontype", arg: "shell", unsupported: true}}, true},
+		{[]string{"host"}, nil, false},
+		{[]string{"host", ""}, nil, false},
+		{[]string{"all", "host", "web"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := parseCriteria(tt.args)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseCriteria(%q) error = %v", tt.args, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("parseCriteria(%q) = %+v, want %+v", tt.args, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("parseCriteria(%q) = %+v, want %+v", tt.args, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestMatchCIDRList(t *testing.T) {
+	tests := []struct {
+		addr string
+		list string
+		want bool
+		ok   bool
+	}{
+		{"192.168.1.10", "192.168.1.0/24", true, true},
+		{"192.168.2.10", "192.168.1.0/24", false, true},
+		{"10.0.0.1", "192.168.1.0/24,10.0.0.0/8", true, true},
+		{"fd00::1", "fd00::/8", true, true},
+		{"10.0.0.1", "10.0.0.1", false, false},
+	}
+
+	for _, tt := range tests {
+		got, err := matchCIDRList(net.ParseIP(tt.addr), tt.list)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("matchCIDRList(%s, %q) = %v, %v", tt.addr, tt.list, got, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package sshconfig
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout is how long a Match exec command may run before it is
+// killed and treated as not matching.
+const DefaultExecTimeout = 5 * time.Second
+
+// DefaultSystemConfig returns the path of the system wide config file.
+func DefaultSystemConfig() string {
+	return filepath.Join(SystemConfigDir, "ssh_config")
+}
+
+// Resolver computes the options that apply to a host from the user and system
+// config files, evaluating Host patterns, Match blocks and Include directives
+// with the semantics of OpenSSH.
+type Resolver struct {
+	User   *Config // May be nil
+	System *Config // May be nil
+
+	// ExecTimeout limits the run time of Match exec commands, it defaults to
+	// DefaultExecTimeout.
+	ExecTimeout time.Duration
+	// SkipExec leaves out Match blocks with exec criteria instead of running
+	// their commands, for previews that must not run commands of the user.
+	SkipExec bool
+}
+
+// Resolve returns the options OpenSSH would use when connecting to alias.
+//
+// Like OpenSSH, the files are read a second time with the expanded HostName
+// as host name if a Match block uses the "final" or "canonical" criteria or
+// CanonicalizeHostname is enabled. Options obtained in the first pass keep
+// their values.
+func (r *Resolver) Resolve(alias string) (*Host, error) {
+	e := &evaluation{
+		resolver:     r,
+		host:         strings.ToLower(alias),
+		originalHost: alias,
+	}
+
+	if err := e.pass(); err != nil {
+		return nil, err
+	}
+
+	canonicalize := strings.ToLower(e.get("CanonicalizeHostname"))
+	if e.wantFinal || (canonicalize != "" && canonicalize != "no") {
+		e.host = e.hostname()
+		e.final = true
+		if err := e.pass(); err != nil {
+			return nil, err
+		}
+	}
+
+	options := firstValues(e.options)
+	for i, o := range options {
+		if o.Keyword == "HostName" {
+			options[i].Args = []string{Tokens{'h': alias}.Expand(o.Value())}
+		}
+	}
+
+	h := newHost(alias, nil, options)
+	h.SkippedExec = e.skippedExec
+	return h, nil
+}
+
+// evaluation is the state of resolving a single host.
+type evaluation struct {
+	resolver     *Resolver
+	host         string // Name matched by Host lines
+	originalHost string // Name given by the user
+	final        bool
+	wantFinal    bool
+	skippedExec  bool
+	options      []Option
+	localAddrs   []net.IP
+}
+
+// pass reads the user config followed by the system config.
+func (e *evaluation) pass() error {
+	for _, c := range []*Config{e.resolver.User, e.resolver.System} {
+		if c == nil {
+			continue
+		}
+		if err := e.read(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read applies the options of every active block of c. Files included from
+// an active block are read in place; files included from an inactive block are
+// skipped entirely.
+func (e *evaluation) read(c *Config) error {
+	for _, b := range c.Blocks {
+		active, err := e.active(b)
+		if err != nil {
+			return &ParseError{Path: b.Path, Line: b.Line, Err: err}
+		}
+		if !active {
+			continue
+		}
+
+		for _, o := range b.Options {
+			if o.Keyword != "Include" {
+				e.options = append(e.options, o)
+				continue
+			}
+			for _, inc := range c.Included(o) {
+				if err := e.read(inc); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// active reports whether the options of block b apply.
+func (e *evaluation) active(b *Block) (bool, error) {
+	switch b.Kind {
+	case HostBlock:
+		return matchPatternList(e.host, b.Patterns, true), nil
+	case MatchBlock:
+		return e.match(b.Patterns)
+	}
+	return true, nil
+}
+
+// match evaluates the criteria of a Match line. All criteria have to match;
+// exec commands are only run if all criteria before them matched.
+func (e *evaluation) match(args []string) (bool, error) {
+	criteria, err := parseCriteria(args)
+	if err != nil {
+		return false, err
+	}
+
+	result := true
+	for _, c := range criteria {
+		var matched bool
+		list := strings.Split(c.arg, ",")
+
+		if c.unsupported {
+			// The block is left out whether the criterion is negated or not
+			result = false
+			continue
+		}
+
+		switch c.name {
+		case "all":
+			matched = true
+		case "canonical", "final":
+			e.wantFinal = true
+			matched = e.final
+		case "exec":
+			if !result {
+				continue
+			}
+			if e.resolver.SkipExec {
+				e.skippedExec = true
+				result = false
+				continue
+			}
+			matched = e.exec(c.arg)
+		case "host":
+			matched = matchPatternList(e.hostname(), list, true)
+		case "originalhost":
+			matched = matchPatternList(e.originalHost, list, false)
+		case "user":
+			matched = matchPatternList(e.remoteUser(), list, false)
+		case "localuser":
+			name, _, _ := currentUser()
+			matched = matchPatternList(name, list, false)
+		case "localnetwork":
+			matched, err = e.localNetwork(c.arg)
+			if err != nil {
+				return false, err
+			}
+		case "tagged":
+			matched = matchPatternList(e.get("Tag"), list, false)
+		}
+
+		if c.negated {
+			matched = !matched
+		}
+		result = result && matched
+	}
+
+	return result, nil
+}
+
+// exec runs the command of a Match exec criterion with the user's shell and
+// reports whether it exited successfully within the time limit.
+func (e *evaluation) exec(command string) bool {
+	timeout := e.resolver.ExecTimeout
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return ShellCommand(ctx, e.tokens().Expand(command)).Run() == nil
+}
+
+// ShellCommand returns a command that runs command with the user's shell, the
+// way OpenSSH runs Match exec and ProxyCommand commands.
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.CommandContext(ctx, shell, "-c", command)
+}
+
+// localNetwork reports whether any address of a local interface is inside one
+// of the networks in list.
+func (e *evaluation) localNetwork(list string) (bool, error) {
+	if e.localAddrs == nil {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return false, err
+		}
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok {
+				e.localAddrs = append(e.localAddrs, n.IP)
+			}
+		}
+	}
+
+	for _, addr := range e.localAddrs {
+		matched, err := matchCIDRList(addr, list)
+		if matched || err != nil {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+// get returns the first value obtained for keyword so far.
+func (e *evaluation) get(keyword string) string {
+	for _, o := range e.options {
+		if o.Keyword == keyword {
+			return o.Value()
+		}
+	}
+	return ""
+}
+
+// hostname returns the host name with HostName applied. In the final pass
+// the host name already is the expanded HostName.
+func (e *evaluation) hostname() string {
+	if hostname := e.get("HostName"); hostname != "" && !e.final {
+		return Tokens{'h': e.host}.Expand(hostname)
+	}
+	return e.host
+}
+
+// remoteUser returns the user to log in as, defaulting to the local user.
+func (e *evaluation) remoteUser() string {
+	if user := e.get("User"); user != "" {
+		return user
+	}
+	name, _, _ := currentUser()
+	return name
+}
+
+// tokens returns the tokens for Match exec commands.
+func (e *evaluation) tokens() Tokens {
+	port := 22
+	if p, err := strconv.Atoi(e.get("Port")); err == nil {
+		port = p
+	}
+	return NewTokens(e.originalHost, e.hostname(), port, e.remoteUser())
+}
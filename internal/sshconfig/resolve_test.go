@@ -0,0 +1,220 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		alias  string
+		want   map[string]string
+	}{
+		{
+			name:   "first value wins",
+			config: "Host web\n  User a\nHost *\n  User b\n  Port 2222\n",
+			alias:  "web",
+			want:   map[string]string{"User": "a", "Port": "2222"},
+		},
+		{
+			name:   "global options come first",
+			config: "User g\nHost web\n  User a\n",
+			alias:  "web",
+			want:   map[string]string{"User": "g"},
+		},
+		{
+			name:   "host patterns ignore case",
+			config: "Host WEB\n  User a\n",
+			alias:  "Web",
+			want:   map[string]string{"User": "a"},
+		},
+		{
+			name:   "negated pattern",
+			config: "Host * !web\n  User x\n",
+			alias:  "web",
+			want:   map[string]string{"User": ""},
+		},
+		{
+			name:   "negated pattern other host",
+			config: "Host * !web\n  User x\n",
+			alias:  "db",
+			want:   map[string]string{"User": "x"},
+		},
+		{
+			name:   "HostName expands %h",
+			config: "Host web\n  HostName %h.example.com\n",
+			alias:  "web",
+			want:   map[string]string{"HostName": "web.example.com"},
+		},
+		{
+			name:   "match host uses HostName",
+			config: "Host web\n  HostName web.example.com\nMatch host *.example.com\n  User m\n",
+			alias:  "web",
+			want:   map[string]string{"User": "m"},
+		},
+		{
+			name:   "match originalhost",
+			config: "Host web\n  HostName other\nMatch originalhost web\n  Port 1\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "1"},
+		},
+		{
+			name:   "match user",
+			config: "Host web\n  User deploy\nMatch user deploy\n  Port 2\nMatch user root\n  Port 3\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "2"},
+		},
+		{
+			name:   "match tagged",
+			config: "Host web\n  Tag prod\nMatch tagged prod\n  Port 3\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "3"},
+		},
+		{
+			name:   "all criteria have to match",
+			config: "Match host web user nobody-else\n  Port 4\n",
+			alias:  "web",
+			want:   map[string]string{"Port": ""},
+		},
+		{
+			name:   "negated criterion",
+			config: "Match !host db\n  Port 5\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "5"},
+		},
+		{
+			name:   "match all",
+			config: "Match all\n  Port 6\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "6"},
+		},
+		{
+			name:   "unsupported criteria never match",
+			config: "Match sessiontype shell\n  Port 4\nMatch !sessiontype shell\n  Port 5\nHost *\n  Port 6\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "6"},
+		},
+		{
+			name:   "final pass keeps first pass values",
+			config: "Host web\n  User w\nMatch final\n  User f\n  Port 7\n",
+			alias:  "web",
+			want:   map[string]string{"User": "w", "Port": "7"},
+		},
+		{
+			name:   "final pass matches the HostName",
+			config: "Host web\n  HostName web.example.com\nMatch final host web.example.com\n  Port 8\n",
+			alias:  "web",
+			want:   map[string]string{"Port": "8"},
+		},
+		{
+			name:   "canonicalization reads the files again",
+			config: "Host web\n  HostName web.example.com\n  CanonicalizeHostname yes\nHost web.example.com\n  User c\n",
+			alias:  "web",
+			want:   map[string]string{"User": "c"},
+		},
+		{
+			name:   "no second pass without canonicalization",
+			config: "Host web\n  HostName web.example.com\nHost web.example.com\n  User c\n",
+			alias:  "web",
+			want:   map[string]string{"User": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Resolver{User: mustParse(t, tt.config)}
+			h, err := r.Resolve(tt.alias)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for keyword, want := range tt.want {
+				if got := h.Get(keyword); got != want {
+					t.Errorf("%s = %q, want %q", keyword, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveMultiValue(t *testing.T) {
+	r := &Resolver{
+		User:   mustParse(t, "Host web\n  IdentityFile ~/.ssh/a\nHost *\n  IdentityFile ~/.ssh/b\n  IdentityFile ~/.ssh/a\n"),
+		System: mustParse(t, "Host *\n  IdentityFile ~/.ssh/c\n  User system\n"),
+	}
+	h, err := r.Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"~/.ssh/a", "~/.ssh/b", "~/.ssh/c"}; !slices.Equal(h.IdentityFiles, want) {
+		t.Errorf("IdentityFiles = %q, want %q", h.IdentityFiles, want)
+	}
+	if h.User != "system" {
+		t.Errorf("User = %q, the system config was not read", h.User)
+	}
+}
+
+func TestResolveInclude(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"config": "Host db\n  Include $DIR/db\nHost web\n  Include $DIR/web\n",
+		"web":    "User w\n",
+		"db":     "User d\nPort 2\n",
+	})
+	c, err := Load(filepath.Join(dir, "config"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := (&Resolver{User: c}).Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.User != "w" || h.Get("Port") != "" {
+		t.Errorf("got User %q Port %q, the include of an inactive block was read", h.User, h.Get("Port"))
+	}
+}
+
+func TestResolveExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	t.Setenv("SHELL", "/bin/sh")
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	config := strings.Join([]string{
+		"Match host other exec \"touch " + marker + "\"",
+		"  Port 1",
+		"Match exec false",
+		"  User f",
+		"Match exec \"test %n = web\"",
+		"  User t",
+		"Match !exec false",
+		"  Port 2",
+		"",
+	}, "\n")
+
+	h, err := (&Resolver{User: mustParse(t, config)}).Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.User != "t" || h.Get("Port") != "2" || h.SkippedExec {
+		t.Errorf("got User %q Port %q SkippedExec %v", h.User, h.Get("Port"), h.SkippedExec)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("exec ran although an earlier criterion did not match")
+	}
+
+	// Previews leave out every block with an exec criterion
+	h, err = (&Resolver{User: mustParse(t, config), SkipExec: true}).Resolve("web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.User != "" || h.Get("Port") != "" || !h.SkippedExec {
+		t.Errorf("got User %q Port %q SkippedExec %v", h.User, h.Get("Port"), h.SkippedExec)
+	}
+}
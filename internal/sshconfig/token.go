@@ -0,0 +1,162 @@
+package sshconfig
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnterminatedQuote = errors.New("unterminated quote")
+	errMissingArgument   = errors.New("missing argument")
+)
+
+// isSpace reports whether c separates words in a configuration line.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
+
+// lineParts describes where the keyword and arguments of a line are, so a
+// line can be rewritten without touching its indentation, separator or
+// trailing comment.
+type lineParts struct {
+	keyword   string
+	args      []string
+	indent    int // End of the leading whitespace
+	argsStart int
+	argsEnd   int
+}
+
+// scanLine splits a single configuration line into its keyword and
+// arguments the same way OpenSSH's readconf.c does. The keyword is separated
+// from its arguments by whitespace and/or a single '='. Blank lines and
+// comments yield an empty keyword.
+func scanLine(line string) (lineParts, error) {
+	var p lineParts
+
+	i := 0
+	for i < len(line) && isSpace(line[i]) {
+		i++
+	}
+	p.indent = i
+	if i == len(line) || line[i] == '#' {
+		return p, nil
+	}
+
+	// The keyword ends at the first whitespace or '=' character
+	for i < len(line) && !isSpace(line[i]) && line[i] != '=' {
+		i++
+	}
+	p.keyword = line[p.indent:i]
+
+	// Skip the separator, allowing at most one '=' surrounded by whitespace
+	for i < len(line) && isSpace(line[i]) {
+		i++
+	}
+	if i < len(line) && line[i] == '=' {
+		i++
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+	}
+	p.argsStart = i
+
+	if p.keyword == "" {
+		return p, errMissingArgument
+	}
+
+	args, end, err := splitArgs(line[i:])
+	if err != nil {
+		return p, err
+	}
+	p.args = args
+	p.argsEnd = i + end
+
+	return p, nil
+}
+
+// splitArgs splits s into words following the rules of OpenSSH's argv_split:
+// single and double quotes group words, a backslash escapes quotes,
+// backslashes and (outside quotes) spaces, and an unquoted '#' at the start of
+// a word starts a comment. It also returns the offset just past the last word.
+func splitArgs(s string) ([]string, int, error) {
+	var args []string
+
+	i, end := 0, 0
+	for i < len(s) {
+		// Skip whitespace between words
+		for i < len(s) && isSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) || s[i] == '#' {
+			break
+		}
+
+		var arg strings.Builder
+		var quote byte
+		for ; i < len(s); i++ {
+			c := s[i]
+			switch {
+			case c == '\\' && i+1 < len(s) &&
+				(s[i+1] == '\'' || s[i+1] == '"' || s[i+1] == '\\' || (quote == 0 && s[i+1] == ' ')):
+				i++
+				arg.WriteByte(s[i])
+				continue
+			case quote == 0 && isSpace(c):
+			case quote == 0 && (c == '"' || c == '\''):
+				quote = c
+				continue
+			case quote != 0 && c == quote:
+				quote = 0
+				continue
+			default:
+				arg.WriteByte(c)
+				continue
+			}
+			break
+		}
+
+		if quote != 0 {
+			return nil, 0, errUnterminatedQuote
+		}
+
+		args = append(args, arg.String())
+		end = i
+	}
+
+	return args, end, nil
+}
+
+// SplitArgs splits s into words using the quoting rules of config files.
+func SplitArgs(s string) ([]string, error) {
+	args, _, err := splitArgs(s)
+	return args, err
+}
+
+// quoteArg returns arg in a form that splitArgs reads back unchanged.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\#") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		if arg[i] == '"' || arg[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(arg[i])
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// JoinArgs quotes and joins args so they can be written to a config file.
+func JoinArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+
+	return strings.Join(quoted, " ")
+}
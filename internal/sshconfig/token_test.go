@@ -0,0 +1,109 @@
+package sshconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScanLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		keyword string
+		args    []string
+		raw     string // The arguments as written
+		ok      bool
+	}{
+		{"", "", nil, "", true},
+		{"   # comment", "", nil, "", true},
+		{"HostName example.com", "HostName", []string{"example.com"}, "example.com", true},
+		{"\tUser\troot", "User", []string{"root"}, "root", true},
+		{"Port=22", "Port", []string{"22"}, "22", true},
+		{"Port = 22", "Port", []string{"22"}, "22", true},
+		{"Port  =  22  # ssh", "Port", []string{"22"}, "22", true},
+		{"Host a b  c", "Host", []string{"a", "b", "c"}, "a b  c", true},
+		{`ProxyCommand "nc %h %p"`, "ProxyCommand", []string{"nc %h %p"}, `"nc %h %p"`, true},
+		{"IdentityFile 'my key'", "IdentityFile", []string{"my key"}, "'my key'", true},
+		{"User", "User", nil, "", true},
+		{"=value", "", nil, "", false},
+		{`HostName "unterminated`, "HostName", nil, "", false},
+	}
+
+	for _, tt := range tests {
+		p, err := scanLine(tt.line)
+		if (err == nil) != tt.ok {
+			t.Errorf("scanLine(%q) error = %v", tt.line, err)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		if p.keyword != tt.keyword || !slices.Equal(p.args, tt.args) {
+			t.Errorf("scanLine(%q) = %q %q, want %q %q", tt.line, p.keyword, p.args, tt.keyword, tt.args)
+		}
+		if raw := tt.line[p.argsStart:p.argsEnd]; tt.args != nil && raw != tt.raw {
+			t.Errorf("scanLine(%q) args written as %q, want %q", tt.line, raw, tt.raw)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+		ok   bool
+	}{
+		{"", nil, true},
+		{"a b\tc", []string{"a", "b", "c"}, true},
+		{`"a b" c`, []string{"a b", "c"}, true},
+		{`'a "b"'`, []string{`a "b"`}, true},
+		{`"a 'b'"`, []string{"a 'b'"}, true},
+		{`a\ b`, []string{"a b"}, true},
+		{`"a\ b"`, []string{`a\ b`}, true},
+		{`a\"b`, []string{`a"b`}, true},
+		{`a\\b`, []string{`a\b`}, true},
+		{`a\nb`, []string{`a\nb`}, true},
+		{`x"y z"w`, []string{"xy zw"}, true},
+		{`""`, []string{""}, true},
+		{"a # comment", []string{"a"}, true},
+		{"a#b", []string{"a#b"}, true},
+		{`"#a"`, []string{"#a"}, true},
+		{`"a`, nil, false},
+		{`'a`, nil, false},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.in)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v, want %q, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"a", "b"}, "a b"},
+		{[]string{"a b"}, `"a b"`},
+		{[]string{""}, `""`},
+		{[]string{`a"b`}, `"a\"b"`},
+		{[]string{`a\b`}, `"a\\b"`},
+		{[]string{"#a"}, `"#a"`},
+		{[]string{"it's"}, `"it's"`},
+		{[]string{"a\tb"}, "\"a\tb\""},
+	}
+
+	for _, tt := range tests {
+		got := JoinArgs(tt.args)
+		if got != tt.want {
+			t.Errorf("JoinArgs(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+
+		// Joined args read back unchanged
+		back, err := SplitArgs(got)
+		if err != nil || !slices.Equal(back, tt.args) {
+			t.Errorf("SplitArgs(JoinArgs(%q)) = %q, %v", tt.args, back, err)
+		}
+	}
+}
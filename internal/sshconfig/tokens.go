@@ -0,0 +1,83 @@
+package sshconfig
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// Tokens holds the values of the percent tokens that may be used in options
+// such as Match exec, ProxyCommand or LocalCommand.
+type Tokens map[byte]string
+
+// NewTokens returns the tokens for a connection to hostname (%h) on port (%p)
+// as remoteUser (%r). The original alias (%n), the connection hash (%C) and
+// the tokens describing the local host and user are derived from them.
+func NewTokens(alias, hostname string, port int, remoteUser string) Tokens {
+	localUser, uid, home := currentUser()
+
+	localHost, _ := os.Hostname()
+	shortHost, _, _ := strings.Cut(localHost, ".")
+
+	t := Tokens{
+		'd': home,
+		'h': hostname,
+		'i': uid,
+		'L': shortHost,
+		'l': localHost,
+		'n': alias,
+		'p': strconv.Itoa(port),
+		'r': remoteUser,
+		'u': localUser,
+	}
+
+	sum := sha1.Sum([]byte(t['l'] + t['h'] + t['p'] + t['r']))
+	t['C'] = hex.EncodeToString(sum[:])
+
+	return t
+}
+
+// Expand replaces the tokens in s. "%%" yields a literal percent sign; unknown
+// tokens are left as they are.
+func (t Tokens) Expand(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if s[i] == '%' {
+			b.WriteByte('%')
+		} else if v, ok := t[s[i]]; ok {
+			b.WriteString(v)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// currentUser returns the name, uid and home directory of the local user.
+func currentUser() (name, uid, home string) {
+	if u, err := user.Current(); err == nil {
+		name, uid, home = u.Username, u.Uid, u.HomeDir
+	}
+	if name == "" {
+		name = os.Getenv("USER")
+	}
+	if h, err := os.UserHomeDir(); err == nil {
+		home = h
+	}
+	return name, uid, home
+}
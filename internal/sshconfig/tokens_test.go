@@ -0,0 +1,47 @@
+package sshconfig
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+)
+
+func TestTokensExpand(t *testing.T) {
+	tokens := Tokens{'h': "example.com", 'p': "2222", 'r': "deploy", 'n': "web"}
+
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"no tokens", "no tokens"},
+		{"%h", "example.com"},
+		{"ssh -p %p %r@%h", "ssh -p 2222 deploy@example.com"},
+		{"%n-%h", "web-example.com"},
+		{"100%%", "100%"},
+		{"%%h", "%h"},
+		{"%x", "%x"},
+		{"trailing %", "trailing %"},
+		{"%", "%"},
+	}
+
+	for _, tt := range tests {
+		if got := tokens.Expand(tt.in); got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewTokens(t *testing.T) {
+	tokens := NewTokens("web", "web.example.com", 2222, "deploy")
+
+	for token, want := range map[byte]string{'n': "web", 'h': "web.example.com", 'p': "2222", 'r': "deploy"} {
+		if got := tokens[token]; got != want {
+			t.Errorf("%%%c = %q, want %q", token, got, want)
+		}
+	}
+
+	sum := sha1.Sum([]byte(tokens['l'] + "web.example.com" + "2222" + "deploy"))
+	if want := hex.EncodeToString(sum[:]); tokens['C'] != want {
+		t.Errorf("%%C = %q, want %q", tokens['C'], want)
+	}
+}
@@ -0,0 +1,532 @@
+package sshconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var errNoBlock = errors.New("block no longer exists in config file")
+
+// Edits made to a Config only touch the lines they change; every other line,
+// including comments, blank lines and indentation, is written back exactly as
+// it was read. Edits rebuild Blocks, so Block values obtained earlier are stale
+// afterwards. They may still be passed to the edit methods, which locate the
+// current block by its Host or Match line.
+
+// Bytes returns the contents of the file including all edits.
+func (c *Config) Bytes() []byte {
+	var b strings.Builder
+	for _, line := range c.lines {
+		b.WriteString(line.text)
+		b.WriteString(line.eol)
+	}
+	return []byte(b.String())
+}
+
+// Save writes the file back to disk. The file is replaced atomically and keeps
+// its permissions; if the path is a symlink its target is written.
+func (c *Config) Save() error {
+	if c.Path == "" {
+		return errors.New("config file has no path")
+	}
+
+	path := c.Path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mode := os.FileMode(0o600)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(c.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// SetPatterns replaces the patterns of a Host block.
+func (c *Config) SetPatterns(b *Block, patterns []string) error {
+	b, err := c.current(b)
+	if err != nil {
+		return err
+	}
+	if b.Kind == GlobalBlock {
+		return errors.New("the global block has no patterns")
+	}
+
+	c.replaceArgs(b.Line-1, patterns)
+	return c.build()
+}
+
+// SetOption sets keyword to args in block b. The first line setting the
+// keyword is rewritten in place; if there is none a new line is added after
+// the last option of the block. Empty args remove the keyword from the block.
+func (c *Config) SetOption(b *Block, keyword string, args []string) error {
+	b, err := c.current(b)
+	if err != nil {
+		return err
+	}
+	keyword, _ = CanonicalKeyword(keyword)
+
+	var existing []int
+	for _, o := range b.Options {
+		if o.Keyword == keyword {
+			existing = append(existing, o.Line-1)
+		}
+	}
+
+	switch {
+	case len(existing) > 0 && len(args) > 0:
+		c.replaceArgs(existing[0], args)
+	case len(existing) > 0:
+		// Clearing a multi valued keyword only removes its first value,
+		// other keywords are removed completely so no later value takes over
+		if multiValue[keyword] {
+			existing = existing[:1]
+		}
+		for i := len(existing) - 1; i >= 0; i-- {
+			c.deleteLines(existing[i], existing[i]+1)
+		}
+	case len(args) > 0:
+		c.insertLines(c.insertionPoint(b), c.indentation(b)+keyword+" "+JoinArgs(args))
+	}
+
+	return c.build()
+}
+
+// Notes returns the comment lines directly following the Host or Match line of
+// b, without their leading '#'.
+func (c *Config) Notes(b *Block) string {
+	b, err := c.current(b)
+	if err != nil || b.Kind == GlobalBlock {
+		return ""
+	}
+
+	start, end := c.notesRange(b)
+	notes := make([]string, 0, end-start)
+	for _, line := range c.lines[start:end] {
+		prefix := notePrefix(line.text)
+		notes = append(notes, line.text[len(prefix):])
+	}
+
+	return strings.Join(notes, "\n")
+}
+
+// notePrefix returns the part of a comment line before the note: the
+// indentation, the '#' and a single space following it.
+func notePrefix(text string) string {
+	n := len(text) - len(strings.TrimLeft(text, " \t")) + 1
+	if n < len(text) && text[n] == ' ' {
+		n++
+	}
+	return text[:n]
+}
+
+// SetNotes replaces the comment lines directly following the Host or Match
+// line of b with notes. Lines that keep their note are left as they are and
+// changed lines keep the '#' prefix of the line they replace.
+func (c *Config) SetNotes(b *Block, notes string) error {
+	b, err := c.current(b)
+	if err != nil {
+		return err
+	}
+	if b.Kind == GlobalBlock {
+		return errors.New("the global block has no notes")
+	}
+
+	start, end := c.notesRange(b)
+	var old []string
+	for _, line := range c.lines[start:end] {
+		old = append(old, line.text)
+	}
+	c.deleteLines(start, end)
+
+	notes = strings.TrimRight(notes, "\n")
+	if notes == "" {
+		return c.build()
+	}
+
+	prefix := c.indentation(b) + "# "
+	var lines []string
+	for i, note := range strings.Split(notes, "\n") {
+		note = strings.TrimRight(note, " \t\r")
+		if i < len(old) {
+			prefix = notePrefix(old[i])
+			if old[i][len(prefix):] == note {
+				lines = append(lines, old[i])
+				continue
+			}
+		}
+		if note == "" {
+			lines = append(lines, strings.TrimRight(prefix, " "))
+		} else {
+			lines = append(lines, prefix+note)
+		}
+	}
+	c.insertLines(start, lines...)
+
+	return c.build()
+}
+
+// AddHost appends a new Host block with the given patterns to the end of the
+// file, separated from the previous content by a blank line.
+func (c *Config) AddHost(patterns []string) (*Block, error) {
+	if len(patterns) == 0 {
+		return nil, errMissingArgument
+	}
+
+	var lines []string
+	if n := len(c.lines); n > 0 && strings.TrimSpace(c.lines[n-1].text) != "" {
+		lines = append(lines, "")
+	}
+	lines = append(lines, "Host "+JoinArgs(patterns))
+
+	c.insertLines(len(c.lines), lines...)
+	c.lines[len(c.lines)-1].eol = c.eol()
+
+	if err := c.build(); err != nil {
+		return nil, err
+	}
+
+	return c.Blocks[len(c.Blocks)-1], nil
+}
+
+// Snapshot holds the contents of a Config to roll edits back to.
+type Snapshot struct {
+	lines []rawLine
+}
+
+// Snapshot returns the current contents of c.
+func (c *Config) Snapshot() *Snapshot {
+	return &Snapshot{lines: append([]rawLine(nil), c.lines...)}
+}
+
+// Rollback discards the edits made since snapshot was taken.
+func (c *Config) Rollback(snapshot *Snapshot) error {
+	c.lines = append([]rawLine(nil), snapshot.lines...)
+	return c.build()
+}
+
+// DuplicateHost inserts a copy of the Host block b with the given patterns
+// right after it and returns the copy. Comments within the block, including
+// its notes, are only copied if comments is set.
+func (c *Config) DuplicateHost(b *Block, patterns []string, comments bool) (*Block, error) {
+	b, err := c.current(b)
+	if err != nil {
+		return nil, err
+	}
+	if b.Kind != HostBlock {
+		return nil, errors.New("only Host blocks can be duplicated")
+	}
+	if len(patterns) == 0 {
+		return nil, errMissingArgument
+	}
+
+	end := c.hostEnd(b)
+	var lines []string
+	for _, line := range c.lines[b.Line:end] {
+		text := strings.TrimSpace(line.text)
+		if !comments && (text == "" || strings.HasPrefix(text, "#")) {
+			continue
+		}
+		lines = append(lines, line.text)
+	}
+
+	// The Host line keeps its spelling and trailing comment
+	original := c.lines[b.Line-1].text
+	c.replaceArgs(b.Line-1, patterns)
+	header := c.lines[b.Line-1].text
+	c.lines[b.Line-1].text = original
+
+	c.insertLines(end, append([]string{"", header}, lines...)...)
+	if err := c.build(); err != nil {
+		return nil, err
+	}
+
+	// The copy starts after the blank line
+	for _, cb := range c.Blocks {
+		if cb.Line == end+2 {
+			return cb, nil
+		}
+	}
+	return nil, errNoBlock
+}
+
+// RemovedBlock holds the lines of a block removed from a file, so it can be
+// restored.
+type RemovedBlock struct {
+	index int // Index of the first removed line
+	lines []rawLine
+
+	// The lines around the removed ones, to find the place again after
+	// other edits. Nil at the start or end of the file.
+	before, after *string
+}
+
+// RemoveHost removes the Host block b together with its notes, its options
+// and the comment lines directly above it. Comments that follow its last
+// option are kept, as they usually introduce the next block.
+func (c *Config) RemoveHost(b *Block) (*RemovedBlock, error) {
+	b, err := c.current(b)
+	if err != nil {
+		return nil, err
+	}
+	if b.Kind != HostBlock {
+		return nil, errors.New("only Host blocks can be removed")
+	}
+
+	start := b.Line - 1
+	for start > 0 && strings.HasPrefix(strings.TrimLeft(c.lines[start-1].text, " \t"), "#") {
+		start--
+	}
+	end := c.hostEnd(b)
+
+	// Take the blank lines separating the block from the next one along, or
+	// those before it if it is the last one
+	for end < len(c.lines) && strings.TrimSpace(c.lines[end].text) == "" {
+		end++
+	}
+	if end == len(c.lines) {
+		for start > 0 && strings.TrimSpace(c.lines[start-1].text) == "" {
+			start--
+		}
+	}
+
+	removed := &RemovedBlock{index: start, lines: append([]rawLine(nil), c.lines[start:end]...)}
+	if start > 0 {
+		before := c.lines[start-1].text
+		removed.before = &before
+	}
+	if end < len(c.lines) {
+		after := c.lines[end].text
+		removed.after = &after
+	}
+	c.deleteLines(start, end)
+	return removed, c.build()
+}
+
+// Restore inserts the lines of a removed block where they were and returns
+// the restored block. If the file was edited since, the place is found again
+// by the lines that were around the block, and the block is never put into
+// the middle of another one.
+func (c *Config) Restore(r *RemovedBlock) (*Block, error) {
+	i := min(r.index, len(c.lines))
+	if r.after != nil {
+		if j := c.nearestLine(*r.after, i); j >= 0 {
+			i = j
+		}
+	} else if r.before != nil {
+		if j := c.nearestLine(*r.before, i-1); j >= 0 {
+			i = j + 1
+		}
+	}
+	for _, b := range c.Blocks {
+		if b.Kind != GlobalBlock && b.Line-1 < i && i < c.blockEnd(b) {
+			i = c.blockEnd(b)
+		}
+	}
+
+	// A block removed from the end of the file took the blank lines before
+	// it along, they separate it from the next block now
+	lines := append([]rawLine(nil), r.lines...)
+	if r.after == nil && i < len(c.lines) {
+		n := 0
+		for n < len(lines)-1 && strings.TrimSpace(lines[n].text) == "" {
+			n++
+		}
+		lines = append(lines[n:], lines[:n]...)
+	}
+
+	// Lines are inserted as they were, apart from the terminator of a line
+	// that no longer ends the file
+	c.lines = append(c.lines[:i], append(lines, c.lines[i:]...)...)
+	eol := c.eol()
+	for j := max(i-1, 0); j < i+len(lines) && j < len(c.lines)-1; j++ {
+		if c.lines[j].eol == "" {
+			c.lines[j].eol = eol
+		}
+	}
+	if err := c.build(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range c.Blocks {
+		if b.Kind == HostBlock && b.Line > i {
+			return b, nil
+		}
+	}
+	return nil, errNoBlock
+}
+
+// nearestLine returns the index of the line with the given text that is
+// closest to index i, or -1 if there is none.
+func (c *Config) nearestLine(text string, i int) int {
+	nearest := -1
+	for j, line := range c.lines {
+		if line.text == text && (nearest < 0 || abs(j-i) < abs(nearest-i)) {
+			nearest = j
+		}
+	}
+	return nearest
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// current returns the up to date version of block b.
+func (c *Config) current(b *Block) (*Block, error) {
+	if b == nil {
+		return nil, errNoBlock
+	}
+	for _, cb := range c.Blocks {
+		if cb.Kind == b.Kind && cb.Line == b.Line {
+			return cb, nil
+		}
+	}
+	return nil, errNoBlock
+}
+
+// blockEnd returns the index of the first line after block b.
+func (c *Config) blockEnd(b *Block) int {
+	for _, cb := range c.Blocks {
+		if cb.Line > b.Line {
+			return cb.Line - 1
+		}
+	}
+	return len(c.lines)
+}
+
+// hostEnd returns the index of the first line after the notes and options of
+// block b, leaving out the comments and blank lines that follow them.
+func (c *Config) hostEnd(b *Block) int {
+	_, end := c.notesRange(b)
+	if n := len(b.Options); n > 0 && b.Options[n-1].Line > end {
+		end = b.Options[n-1].Line
+	}
+	return min(end, c.blockEnd(b))
+}
+
+// notesRange returns the range of comment lines directly following the Host
+// or Match line of b.
+func (c *Config) notesRange(b *Block) (int, int) {
+	start := b.Line
+	end := start
+	for end < len(c.lines) && strings.HasPrefix(strings.TrimLeft(c.lines[end].text, " \t"), "#") {
+		end++
+	}
+	return start, end
+}
+
+// insertionPoint returns the index where a new option is added to block b:
+// after its last option, or after its notes if it has no options. Comments
+// and blank lines at the end of the block stay where they are.
+func (c *Config) insertionPoint(b *Block) int {
+	if n := len(b.Options); n > 0 {
+		return b.Options[n-1].Line
+	}
+	if b.Kind == GlobalBlock {
+		return 0
+	}
+	_, end := c.notesRange(b)
+	if limit := c.blockEnd(b); end > limit {
+		end = limit
+	}
+	return end
+}
+
+// indentation returns the indentation used for options of block b, borrowing
+// from other blocks of the file if b has no options yet.
+func (c *Config) indentation(b *Block) string {
+	if b.Kind == GlobalBlock {
+		return ""
+	}
+
+	blocks := append([]*Block{b}, c.Blocks...)
+	for _, cb := range blocks {
+		if cb.Kind == GlobalBlock || len(cb.Options) == 0 {
+			continue
+		}
+		text := c.lines[cb.Options[0].Line-1].text
+		p, _ := scanLine(text)
+		return text[:p.indent]
+	}
+
+	return "    "
+}
+
+// eol returns the line terminator used by the file.
+func (c *Config) eol() string {
+	for _, line := range c.lines {
+		if line.eol != "" {
+			return line.eol
+		}
+	}
+	return "\n"
+}
+
+// replaceArgs rewrites the arguments of the line at index i, keeping its
+// indentation, keyword spelling, separator and trailing comment. Lines that
+// already have args are left as they are, including their quoting.
+func (c *Config) replaceArgs(i int, args []string) {
+	text := c.lines[i].text
+	p, _ := scanLine(text)
+	if current, err := SplitArgs(text[p.argsStart:p.argsEnd]); err == nil && slices.Equal(current, args) {
+		return
+	}
+	c.lines[i].text = text[:p.argsStart] + JoinArgs(args) + text[p.argsEnd:]
+}
+
+// insertLines inserts new lines before index i.
+func (c *Config) insertLines(i int, texts ...string) {
+	if len(texts) == 0 {
+		return
+	}
+
+	eol := c.eol()
+	lines := make([]rawLine, len(texts))
+	for j, text := range texts {
+		lines[j] = rawLine{text: text, eol: eol}
+	}
+
+	// Keep a missing newline at the end of the file where it was
+	if i == len(c.lines) && i > 0 && c.lines[i-1].eol == "" {
+		c.lines[i-1].eol = eol
+		lines[len(lines)-1].eol = ""
+	}
+
+	c.lines = append(c.lines[:i], append(lines, c.lines[i:]...)...)
+}
+
+// deleteLines removes the lines in the range [start, end).
+func (c *Config) deleteLines(start, end int) {
+	c.lines = append(c.lines[:start], c.lines[end:]...)
+}
@@ -0,0 +1,228 @@
+package sshconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+// testConfig mixes the styles edits have to preserve: comments, tabs and
+// spaces, a '=' separator, quoted arguments, a trailing comment and no
+// newline at the end of the file.
+const testConfig = "# Global settings\n" +
+	"User me\n" +
+	"\n" +
+	"# Web server\n" +
+	"Host web web.example.com # production\n" +
+	"\tHostName=web.example.com\n" +
+	"\tIdentityFile \"~/.ssh/my key\"\n" +
+	"\n" +
+	"Host db\n" +
+	"    # primary database\n" +
+	"    Port 2222\n" +
+	"    User   admin\n" +
+	"Match host *.internal\n" +
+	"\tProxyJump bastion"
+
+// hostBlock returns the Host block whose first pattern is alias.
+func hostBlock(t *testing.T, c *Config, alias string) *Block {
+	t.Helper()
+	for _, b := range c.Blocks {
+		if b.Kind == HostBlock && b.Patterns[0] == alias {
+			return b
+		}
+	}
+	t.Fatalf("no Host block %s", alias)
+	return nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"mixed", testConfig},
+		{"CRLF", "Host web\r\n  HostName web.example.com\r\n\r\n# comment\r\n"},
+		{"mixed line endings", "Host web\r\n  User a\n  Port 22\r\n"},
+		{"tabs", "Host\tweb\tdb\n\tUser\t\tme \t\n"},
+		{"separators", "User=me\nPort =22\nHostName= example.com\nConnectTimeout = 10\n"},
+		{"quoted args", "Host \"my host\" 'other'\n  IdentityFile \"~/.ssh/a b\" ~/.ssh/c\\ d\n"},
+		{"no final newline", "Host web\n  User me"},
+		{"trailing comments", "Host web # comment\n  User me   #another\n"},
+		{"whitespace only lines", "Host web\n  \n\t\n  User me\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := mustParse(t, tt.text)
+			if got := string(c.Bytes()); got != tt.text {
+				t.Errorf("Bytes() = %q, want %q", got, tt.text)
+			}
+		})
+	}
+}
+
+func TestEdit(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(t *testing.T, c *Config) error
+		// The expected result is testConfig with old replaced by new,
+		// edits leaving the file as it was set neither
+		old, new string
+	}{
+		{
+			name: "SetOption replaces in place",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetOption(hostBlock(t, c, "web"), "hostname", []string{"new.example.com"})
+			},
+			old: "\tHostName=web.example.com\n",
+			new: "\tHostName=new.example.com\n",
+		},
+		{
+			name: "SetOption keeps unchanged quoting",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetOption(hostBlock(t, c, "web"), "IdentityFile", []string{"~/.ssh/my key"})
+			},
+		},
+		{
+			name: "SetOption adds after the last option",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetOption(hostBlock(t, c, "db"), "ProxyJump", []string{"jump host"})
+			},
+			old: "    User   admin\n",
+			new: "    User   admin\n    ProxyJump \"jump host\"\n",
+		},
+		{
+			name: "SetOption removes",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetOption(hostBlock(t, c, "db"), "User", nil)
+			},
+			old: "    User   admin\n",
+			new: "",
+		},
+		{
+			name: "SetOption in the last block",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetOption(c.Blocks[len(c.Blocks)-1], "ProxyJump", []string{"other"})
+			},
+			old: "\tProxyJump bastion",
+			new: "\tProxyJump other",
+		},
+		{
+			name: "SetPatterns keeps the trailing comment",
+			edit: func(t *testing.T, c *Config) error {
+				return c.SetPatterns(hostBlock(t, c, "web"), []string{"web", "www"})
+			},
+			old: "Host web web.example.com # production\n",
+			new: "Host web www # production\n",
+		},
+		{
+			name: "AddHost",
+			edit: func(t *testing.T, c *Config) error {
+				_, err := c.AddHost([]string{"new"})
+				return err
+			},
+			old: "\tProxyJump bastion",
+			new: "\tProxyJump bastion\n\nHost new\n",
+		},
+		{
+			name: "DuplicateHost",
+			edit: func(t *testing.T, c *Config) error {
+				_, err := c.DuplicateHost(hostBlock(t, c, "db"), []string{"db2"}, false)
+				return err
+			},
+			old: "    User   admin\n",
+			new: "    User   admin\n\nHost db2\n    Port 2222\n    User   admin\n",
+		},
+		{
+			name: "DuplicateHost with comments",
+			edit: func(t *testing.T, c *Config) error {
+				_, err := c.DuplicateHost(hostBlock(t, c, "web"), []string{"web2"}, true)
+				return err
+			},
+			old: "\tIdentityFile \"~/.ssh/my key\"\n",
+			new: "\tIdentityFile \"~/.ssh/my key\"\n\nHost web2 # production\n\tHostName=web.example.com\n\tIdentityFile \"~/.ssh/my key\"\n",
+		},
+		{
+			name: "RemoveHost",
+			edit: func(t *testing.T, c *Config) error {
+				_, err := c.RemoveHost(hostBlock(t, c, "web"))
+				return err
+			},
+			old: "# Web server\nHost web web.example.com # production\n\tHostName=web.example.com\n\tIdentityFile \"~/.ssh/my key\"\n\n",
+			new: "",
+		},
+		{
+			name: "RemoveHost and Restore",
+			edit: func(t *testing.T, c *Config) error {
+				removed, err := c.RemoveHost(hostBlock(t, c, "db"))
+				if err != nil {
+					return err
+				}
+				_, err = c.Restore(removed)
+				return err
+			},
+		},
+		{
+			name: "Snapshot and Rollback",
+			edit: func(t *testing.T, c *Config) error {
+				snapshot := c.Snapshot()
+				if err := c.SetOption(hostBlock(t, c, "web"), "User", []string{"other"}); err != nil {
+					return err
+				}
+				if _, err := c.AddHost([]string{"new"}); err != nil {
+					return err
+				}
+				return c.Rollback(snapshot)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(testConfig, tt.old) {
+				t.Fatalf("%q is not part of the test config", tt.old)
+			}
+			want := strings.Replace(testConfig, tt.old, tt.new, 1)
+
+			c := mustParse(t, testConfig)
+			if err := tt.edit(t, c); err != nil {
+				t.Fatal(err)
+			}
+			if got := string(c.Bytes()); got != want {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestEditCRLF(t *testing.T) {
+	c := mustParse(t, "Host web\r\n  User me\r\n")
+	if err := c.SetOption(hostBlock(t, c, "web"), "Port", []string{"22"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddHost([]string{"db"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Host web\r\n  User me\r\n  Port 22\r\n\r\nHost db\r\n"
+	if got := string(c.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestStaleBlock(t *testing.T) {
+	c := mustParse(t, testConfig)
+	web := hostBlock(t, c, "web")
+
+	// Blocks stay usable after edits that keep their Host line in place
+	if err := c.SetOption(web, "Port", []string{"22"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.RemoveHost(web); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetOption(web, "Port", []string{"23"}); err != errNoBlock {
+		t.Errorf("editing a removed block: got error %v, want %v", err, errNoBlock)
+	}
+}